@@ -0,0 +1,221 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/dn"
+	"ktkr.us/pkg/manga/torrent"
+	"ktkr.us/pkg/manga/util"
+)
+
+// batchManifestName is the name of the manifest inside a batch.
+const batchManifestName = "manifest.json"
+
+// BatchManifest lists the releases in a batch.
+type BatchManifest struct {
+	Series   string
+	Group    string
+	Range    string
+	Releases []*BatchRelease
+	Created  time.Time
+}
+
+// BatchRelease is a release in a batch.
+type BatchRelease struct {
+	Identifier string
+	Filename   string
+	Size       util.Bytes
+	Shake256   string
+}
+
+// runBatch packs the archives of a range of identifiers into one batch
+// archive, or into a directory with -dir, along with a manifest.
+func runBatch(cmd *Command, args []string) {
+	rng := args[0]
+	ids, err := core.ParseRange(rng)
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	var (
+		archives []string
+		missing  []core.Identifier
+	)
+	for _, id := range ids {
+		fi, err := core.FirstArchive(id)
+		if err != nil {
+			missing = append(missing, id)
+			continue
+		}
+		archives = append(archives, fi.Name())
+	}
+	if len(missing) > 0 {
+		cmd.Fatalf("no archives for %v (package them first)", missing)
+	}
+
+	name := releaseName(rng, args)
+	out := util.Rooted(name)
+	if !*pkgDir {
+		out += ".zip"
+	}
+	if _, err := os.Stat(out); err == nil && !*pkgF {
+		cmd.Printf("\033[4m%s\033[0m already exists", filepath.Base(out))
+		cmd.Print("  (use flag -f to overwrite)")
+		if !*globalDryRun {
+			os.Exit(1)
+		}
+	}
+
+	if *globalDryRun {
+		plan("%s (%d release%s)", out, len(archives), util.Plural(len(archives)))
+		for _, a := range archives {
+			plan("    %s", a)
+		}
+		plan("    %s", batchManifestName)
+		if *pkgTorrent {
+			writeTorrent(cmd, name, batchTorrentFiles(out, archives), util.Rooted(name+".torrent"), false)
+		}
+		return
+	}
+
+	m := &BatchManifest{
+		Series:  core.Config.Title,
+		Group:   core.Config.Group,
+		Range:   rng,
+		Created: time.Now(),
+	}
+	for i, a := range archives {
+		cmd.Printf("hashing %s", a)
+		f, err := os.Open(util.Rooted(a))
+		if err != nil {
+			cmd.Fatal(err)
+		}
+		sum, err := dn.Shake256(f)
+		fi, _ := f.Stat()
+		f.Close()
+		if err != nil {
+			cmd.Fatal(err)
+		}
+		m.Releases = append(m.Releases, &BatchRelease{
+			Identifier: ids[i].String(),
+			Filename:   a,
+			Size:       util.Bytes(fi.Size()),
+			Shake256:   sum,
+		})
+	}
+	manifest, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	if *pkgDir {
+		err = writeBatchDir(out, archives, manifest)
+	} else {
+		err = writeBatchZip(out, archives, manifest)
+	}
+	if err != nil {
+		cmd.Fatal(err)
+	}
+	cmd.Printf("wrote %s", out)
+
+	if *pkgTorrent {
+		writeTorrent(cmd, name, batchTorrentFiles(out, archives), util.Rooted(name+".torrent"), false)
+	}
+}
+
+// writeBatchZip stores the archives and the manifest in a zip at out. The
+// archives are already compressed, so they are stored as they are.
+func writeBatchZip(out string, archives []string, manifest []byte) error {
+	tmp := out + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	z := zip.NewWriter(file)
+	for _, a := range archives {
+		if err = addStored(z, util.Rooted(a)); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	w, err := z.Create(batchManifestName)
+	if err == nil {
+		_, err = w.Write(manifest)
+	}
+	if err == nil {
+		err = z.Close()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, out)
+}
+
+func addStored(z *zip.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	fih, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	fih.Method = zip.Store
+
+	w, err := z.CreateHeader(fih)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// writeBatchDir links (or copies, across filesystems) the archives into the
+// directory out and writes the manifest there.
+func writeBatchDir(out string, archives []string, manifest []byte) error {
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return err
+	}
+	for _, a := range archives {
+		dst := filepath.Join(out, a)
+		os.Remove(dst)
+		if err := os.Link(util.Rooted(a), dst); err != nil {
+			if err = util.CopyFile(dst, util.Rooted(a)); err != nil {
+				return fmt.Errorf("%s: %v", a, err)
+			}
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(out, batchManifestName), manifest, 0644)
+}
+
+// batchTorrentFiles lists the files of the batch at out for a torrent.
+func batchTorrentFiles(out string, archives []string) []torrent.File {
+	if !*pkgDir {
+		return []torrent.File{{Path: out, Name: filepath.Base(out)}}
+	}
+
+	files := make([]torrent.File, 0, len(archives)+1)
+	for _, a := range archives {
+		files = append(files, torrent.File{Path: filepath.Join(out, a), Name: a})
+	}
+	return append(files, torrent.File{Path: filepath.Join(out, batchManifestName), Name: batchManifestName})
+}
@@ -23,11 +23,13 @@ import (
 
 	"ktkr.us/pkg/dn2/manga"
 	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/cred"
 	"ktkr.us/pkg/manga/util"
 
 	"ktkr.us/pkg/stringdist"
 
 	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/term"
 )
 
 var HTTPClient *http.Client
@@ -35,9 +37,12 @@ var HTTPClient *http.Client
 const (
 	proxyURL              = "/proxy/request"
 	batoto                = "https://www.bato.to"
-	batotoSaveChapterPath = "/add_chapter?do=save"
+	batotoAddChapterPath  = "/add_chapter"
+	batotoSaveChapterPath = batotoAddChapterPath + "?do=save"
 	batotoUploadFilePath  = "/uploader/upload.php"
 	batotoLoginPath       = "/forums/index.php?app=core&module=global&section=login&do=process"
+	batotoLoginFormPath   = "/forums/index.php?app=core&module=global&section=login"
+	credSite              = "batoto"
 	UA                    = "Mozilla/5.0 (Windows NT 6.3, WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/36.0.1985.125 Safari/537.36"
 )
 
@@ -86,7 +91,7 @@ func (b *ChapterUpload) Begin(p chan string) error {
 		doArchive = "1"
 	}
 	p <- "Getting uploader instance..."
-	resp, err := HTTPClient.Get("http://bato.to/add_chapter")
+	resp, err := HTTPClient.Get(batoto + batotoAddChapterPath)
 	if err != nil {
 		return err
 	}
@@ -108,27 +113,11 @@ func (b *ChapterUpload) Begin(p chan string) error {
 	formReader, formWriter := io.Pipe()
 	form := multipart.NewWriter(formWriter)
 
-	var (
-		zipName string
-		zipPath string
-		fi      os.FileInfo
-	)
-
-	if b.Chap.Id.Kind == manga.Volume {
-		zipName = b.Chap.ZipName()
-		zipPath = util.Rooted(zipName)
-		fi, err = os.Stat(zipPath)
-		if err != nil {
-			return err
-		}
-	} else {
-		fi, err = core.FirstArchive(b.Chap.Id)
-		if err != nil {
-			return err
-		}
-		zipName = fi.Name()
-		zipPath = filepath.Join(core.TopLevel(), zipName)
+	zipPath, fi, err := b.archive()
+	if err != nil {
+		return err
 	}
+	zipName := fi.Name()
 	totalSize := util.Bytes(fi.Size())
 
 	/*
@@ -158,11 +147,11 @@ func (b *ChapterUpload) Begin(p chan string) error {
 
 	header := map[string]string{
 		"Origin":     batoto,
-		"Referer":    batoto + "/add_chapter?comic=" + b.SeriesID,
+		"Referer":    batoto + batotoAddChapterPath + "?comic=" + b.SeriesID,
 		"User-Agent": UA,
 	}
 
-	resp, err = util.UploadFileProgress("bato.to:80", batotoUploadFilePath, formReader, form, totalSize, header, p)
+	resp, err = util.UploadFileProgress(HTTPClient, batoto+batotoUploadFilePath, formReader, form, totalSize, header, p)
 	if err != nil {
 		return err
 	}
@@ -255,7 +244,7 @@ func (b *ChapterUpload) Begin(p chan string) error {
 
 	contentType := "multipart/form-data; boundary=" + form.Boundary()
 
-	resp, err = HTTPClient.Post("http://bato.to/add_chapter?do=save", contentType, formReader)
+	resp, err = HTTPClient.Post(batoto+batotoSaveChapterPath, contentType, formReader)
 	if err != nil {
 		return err
 	}
@@ -276,6 +265,48 @@ func (b *ChapterUpload) Begin(p chan string) error {
 	return nil
 }
 
+// archive finds the zip file to upload for the chapter.
+func (b *ChapterUpload) archive() (string, os.FileInfo, error) {
+	if b.Chap.Id.Kind == manga.Volume {
+		zipPath := util.Rooted(b.Chap.ZipName())
+		fi, err := os.Stat(zipPath)
+		return zipPath, fi, err
+	}
+
+	fi, err := core.FirstArchive(b.Chap.Id)
+	if err != nil {
+		return "", nil, err
+	}
+	return filepath.Join(core.TopLevel(), fi.Name()), fi, nil
+}
+
+// Plan describes the requests Begin would make without making them.
+func (b *ChapterUpload) Plan() ([]string, error) {
+	_, fi, err := b.archive()
+	if err != nil {
+		return nil, err
+	}
+
+	var vol string
+	if b.Chap.Id.Kind == manga.Volume {
+		vol = strconv.Itoa(b.Chap.Id.Ordinal)
+	}
+
+	return []string{
+		fmt.Sprintf("POST %s%s  file %q (%v)", batoto, batotoUploadFilePath, fi.Name(), util.Bytes(fi.Size())),
+		fmt.Sprintf("POST %s%s  comic=%s p_group=%s volume=%s chapter=%s title=%q archive=%v",
+			batoto, batotoSaveChapterPath, b.SeriesID, b.GroupID, vol, b.Chap.Num, b.Chap.Title, b.Archive),
+	}, nil
+}
+
+// SeriesURL returns the address of the series page with the given id.
+func SeriesURL(seriesID string) string {
+	return batoto + "/comic/_/comics/-r" + seriesID
+}
+
+// Login logs in to Batoto, resuming the session saved in the credential store
+// if it is still valid. The login comes from the environment, the credential
+// store or the terminal, in that order.
 func Login() {
 	var (
 		resp    *http.Response
@@ -288,20 +319,62 @@ func Login() {
 		log.Fatal(err)
 	}
 
-	p.Set("auth_key", "880ea6a14ea49e853634fbdc5015a024") // TODO, figure out what this is
-	p.Set("referer", "http://bato.to/forums/")
+	store, err := cred.Load()
+	if err != nil {
+		log.Fatalln("Batoto login:", err)
+	}
+	account := store.Account(credSite)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	HTTPClient.Jar = jar
+
+	if cookies := account.Live(); len(cookies) > 0 {
+		jar.SetCookies(batotoURL, cookies)
+		if ok, err := loggedIn(); err != nil {
+			log.Fatalln("Batoto login:", err)
+		} else if ok {
+			fmt.Println("Resumed session.")
+			return
+		}
+	}
+
+	authKey, err := findAuthKey()
+	if err != nil {
+		log.Fatalln("Batoto login:", err)
+	}
+
+	p.Set("auth_key", authKey)
+	p.Set("referer", batoto+"/forums/")
 	p.Set("rememberMe", "1")
 	p.Set("anonymous", "0")
 
+	username, password, err := credentials()
+	if err != nil {
+		log.Fatalln("Batoto login:", err)
+	}
+	if username == "" || password == "" {
+		username, password = account.Username, account.Password
+	}
+	stored := username != "" && password != ""
+	if !stored && util.NoInput {
+		log.Fatal("Batoto login: no credentials given (set MANGA_BATOTO_USER and MANGA_BATOTO_PASSWORD or MANGA_BATOTO_CREDENTIALS)")
+	}
+
+	rejected := false
 	for {
-		fmt.Print("Batoto username: ")
-		scanner.Scan()
-		p.Set("ips_username", scanner.Text())
+		if !stored {
+			fmt.Print("Batoto username: ")
+			scanner.Scan()
+			username = scanner.Text()
 
-		fmt.Print("Batoto password: ")
-		//p.Set("ips_password", getPassword(scanner))
-		scanner.Scan()
-		p.Set("ips_password", scanner.Text())
+			fmt.Print("Batoto password: ")
+			password = getPassword(scanner)
+		}
+		p.Set("ips_username", username)
+		p.Set("ips_password", password)
 
 		resp, err = HTTPClient.PostForm(batoto+batotoLoginPath, p)
 		if err != nil {
@@ -311,17 +384,106 @@ func Login() {
 		if loginSuccessful(resp) {
 			break
 		}
+		if stored {
+			if util.NoInput {
+				log.Fatal("Batoto login: stored username or password incorrect")
+			}
+			fmt.Println("Stored username or password incorrect.")
+			stored, rejected = false, true
+		}
 	}
 
 	cookies := resp.Cookies()
-	jar, err := cookiejar.New(nil)
+	jar.SetCookies(batotoURL, cookies)
+	fmt.Println("Logged in.")
+
+	account.Cookies = cookies
+	// a login that replaces a rejected one is remembered in its place
+	if rejected || !stored && util.Promptf("Remember Batoto login?") {
+		account.Username = username
+		account.Password = password
+	}
+	if err = store.Save(); err != nil {
+		log.Print("Batoto login: saving session: ", err)
+	}
+}
+
+// getPassword reads a password from the terminal without echoing it. If stdin
+// isn't a terminal, the next line is read from s instead.
+func getPassword(s *bufio.Scanner) string {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		s.Scan()
+		return s.Text()
+	}
+
+	password, err := term.ReadPassword(fd)
+	fmt.Println()
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalln("reading password:", err)
 	}
-	jar.SetCookies(batotoURL, cookies)
+	return string(password)
+}
 
-	HTTPClient.Jar = jar
-	fmt.Println("Logged in.")
+// findAuthKey fetches the login form's auth key.
+func findAuthKey() (string, error) {
+	resp, err := HTTPClient.Get(batoto + batotoLoginFormPath)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	key, ok := doc.Find(`input[name="auth_key"]`).First().Attr("value")
+	if !ok {
+		return "", errors.New("couldn't locate login auth key")
+	}
+	return key, nil
+}
+
+// loggedIn reports whether the current session can reach the upload page.
+func loggedIn() (bool, error) {
+	resp, err := HTTPClient.Get(batoto + batotoAddChapterPath)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	return doc.Find("select#comic").Length() > 0, nil
+}
+
+// credentials returns the Batoto login from the environment: either
+// MANGA_BATOTO_USER and MANGA_BATOTO_PASSWORD, or a file named by
+// MANGA_BATOTO_CREDENTIALS holding the username and password on separate
+// lines. Both are empty if none is set.
+func credentials() (username, password string, err error) {
+	username = os.Getenv("MANGA_BATOTO_USER")
+	password = os.Getenv("MANGA_BATOTO_PASSWORD")
+	if username != "" && password != "" {
+		return username, password, nil
+	}
+
+	name := os.Getenv("MANGA_BATOTO_CREDENTIALS")
+	if name == "" {
+		return "", "", nil
+	}
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	if len(lines) < 2 {
+		return "", "", fmt.Errorf("%s: expected username and password on separate lines", name)
+	}
+	return strings.TrimSpace(lines[0]), strings.TrimSpace(lines[1]), nil
 }
 
 // find the ids of the named series and group
@@ -335,7 +497,7 @@ func FindInfo(series, group string) (seriesID, groupID string, err error) {
 	}
 
 	// don't use goquery's http client because we need the login cookie for this page
-	resp, err := HTTPClient.Get("http://bato.to/add_chapter")
+	resp, err := HTTPClient.Get(batoto + batotoAddChapterPath)
 	if err != nil {
 		return "", "", err
 	}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"ktkr.us/pkg/dn2/manga"
+
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/journal"
+	"ktkr.us/pkg/manga/util"
+)
+
+// ComicInfo is the ComicInfo.xml metadata that comic readers look for in
+// archives. The fields are in the order of the schema, which readers may
+// enforce.
+type ComicInfo struct {
+	XMLName         xml.Name `xml:"ComicInfo"`
+	Title           string   `xml:",omitempty"`
+	Series          string
+	Number          string `xml:",omitempty"`
+	Volume          int    `xml:",omitempty"`
+	Notes           string `xml:",omitempty"`
+	Letterer        string `xml:",omitempty"`
+	Translator      string `xml:",omitempty"`
+	Web             string `xml:",omitempty"`
+	PageCount       int    `xml:",omitempty"`
+	ScanInformation string `xml:",omitempty"`
+
+	Pages *ComicPages `xml:",omitempty"` // only the double pages
+}
+
+// ComicPages lists pages of an archive.
+type ComicPages struct {
+	Page []ComicPage
+}
+
+// ComicPage describes the page at index Image in the archive.
+type ComicPage struct {
+	Image      int  `xml:",attr"`
+	DoublePage bool `xml:",attr,omitempty"`
+}
+
+const comicInfoName = "ComicInfo.xml"
+
+// newComicInfo makes the metadata for an archive of id, or of the chapter
+// chap of it if chap isn't nil.
+func newComicInfo(id core.Identifier, chap *core.ChapSplit, credits []*core.Credit) *ComicInfo {
+	info := &ComicInfo{
+		Series:          core.Config.Title,
+		ScanInformation: core.Config.Group,
+	}
+
+	switch {
+	case chap != nil:
+		info.Number = chap.Num
+		info.Title = chap.Title
+		info.Volume = id.Ordinal
+	case id.Kind == manga.Volume:
+		info.Volume = id.Ordinal
+	default:
+		info.Number = strconv.Itoa(id.Ordinal)
+	}
+	if core.Config.Remote != "" {
+		info.Web = "http://" + core.Config.Remote
+	}
+
+	notes := make([]string, len(credits))
+	for i, c := range credits {
+		role := strings.ToLower(c.Role)
+		names := strings.Join(c.Names, ", ")
+		switch {
+		case strings.HasPrefix(role, "translat"):
+			info.Translator = names
+		case strings.HasPrefix(role, "typeset"), strings.HasPrefix(role, "letter"):
+			info.Letterer = names
+		}
+		notes[i] = c.String()
+	}
+	info.Notes = strings.Join(notes, "\n")
+
+	return info
+}
+
+// doublePages lists the images in ims shaped like spreads, or returns nil if
+// there are none.
+func doublePages(ims []*Image) *ComicPages {
+	var pages []ComicPage
+	for i, im := range ims {
+		if im.Wide {
+			pages = append(pages, ComicPage{Image: i, DoublePage: true})
+		}
+	}
+	if len(pages) == 0 {
+		return nil
+	}
+	return &ComicPages{Page: pages}
+}
+
+func (info *ComicInfo) WriteTo(w io.Writer) (int64, error) {
+	buf, err := xml.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.WriteString(w, xml.Header+string(buf)+"\n")
+	return int64(n), err
+}
+
+// creditsPage renders credits as a white page the size of like, written as
+// credits.png in the identifier's directory so that it sorts after the
+// numbered pages. The page is recorded in j.
+func creditsPage(cmd *Command, id core.Identifier, credits []*core.Credit, like *Image, j *journal.Journal) *Image {
+	lines := make([]string, 0, len(credits)+2)
+	lines = append(lines, core.Config.Group, "")
+	for _, c := range credits {
+		lines = append(lines, c.String())
+	}
+
+	w, h := like.size()
+	page := &Image{Path: filepath.Join(core.TopLevel(), id.String(), "credits.png"), Kind: Page}
+	args := func(text string) []string {
+		return []string{
+			"-size", fmt.Sprintf("%dx%d", w, h),
+			"xc:white",
+			"-gravity", "center",
+			"-fill", "black",
+			"-pointsize", strconv.Itoa(h / 40),
+			"-annotate", "+0+0", "@" + text,
+			page.Path,
+		}
+	}
+	if *globalDryRun {
+		plan("convert %s", quoteArgs(args("<credits>")))
+		return page
+	}
+
+	// the text is read from a file so that names aren't taken for options or
+	// files to include
+	file, err := ioutil.TempFile("", "manga-credits-*.txt")
+	if err != nil {
+		cmd.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	_, err = io.WriteString(file, annotateEscaper.Replace(strings.Join(lines, "\n")))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	if err = j.Write(page.Path); err != nil {
+		cmd.Fatal(err)
+	}
+	util.System("convert", args(file.Name())...)
+	return page
+}
+
+// annotateEscaper escapes the characters ImageMagick interprets in the text of
+// -annotate.
+var annotateEscaper = strings.NewReplacer("%", "%%", "\\", "\\\\")
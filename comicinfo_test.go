@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestComicInfoOrder(t *testing.T) {
+	// the elements ComicInfo has, in the order of the ComicInfo schema
+	order := []string{"Title", "Series", "Number", "Volume", "Notes", "Letterer",
+		"Translator", "Web", "PageCount", "ScanInformation", "Pages"}
+
+	info := &ComicInfo{
+		Title:           "t",
+		Series:          "s",
+		Number:          "1",
+		Volume:          1,
+		Notes:           "n",
+		Letterer:        "l",
+		Translator:      "tl",
+		Web:             "w",
+		PageCount:       1,
+		ScanInformation: "g",
+		Pages:           &ComicPages{Page: []ComicPage{{Image: 0, DoublePage: true}}},
+	}
+	buf, err := xml.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := string(buf)
+	last := -1
+	for _, name := range order {
+		i := strings.Index(doc, "<"+name+">")
+		if i < last {
+			t.Errorf("%s isn't in schema order:\n%s", name, doc)
+		}
+		last = i
+	}
+}
@@ -22,9 +22,35 @@ var Config struct {
 	DLServ        string `json:",omitempty"`
 	BatotoID      string `json:",omitempty"`
 	BatotoGroupID string `json:",omitempty"`
+
+	CoverHeight  int `json:",omitempty"` // pixels, default 1200
+	ThumbHeight  int `json:",omitempty"` // pixels, default 300
+	CoverQuality int `json:",omitempty"` // JPEG quality, default 90
+
+	Staff []Credit `json:",omitempty"` // series roster, see Credits
+
+	Destinations []string               `json:",omitempty"` // published to by manga up, default displaynone
+	Forms        map[string]*FormDest   `json:",omitempty"` // form upload destinations by name
+	Mirrors      map[string]*MirrorDest `json:",omitempty"` // mirror destinations by name
+
+	Torrent  *TorrentConfig `json:",omitempty"`
+	Webhooks []*Webhook     `json:",omitempty"`
+
+	Stages   []Stage            `json:",omitempty"` // working folders, in order
+	Pipeline map[string]StageIO `json:",omitempty"` // per-command stage overrides
 }
 
+// LoadConfig loads .manga like LoadSeries, and exits if no group is set, which
+// everything that names or publishes releases needs.
 func LoadConfig() {
+	LoadSeries()
+	if Config.Group == "" {
+		log.Fatal("env MANGA_GROUP or Group in .manga not set")
+	}
+}
+
+// LoadSeries changes into the top level of the series and loads its .manga.
+func LoadSeries() {
 	wd := TopLevel()
 	os.Chdir(wd)
 	Config.Title = filepath.Base(wd)
@@ -35,10 +61,6 @@ func LoadConfig() {
 	if err = json.NewDecoder(file).Decode(&Config); err != nil {
 		log.Fatal(".manga: ", err)
 	}
-
-	if Config.Group == "" {
-		log.Fatal("env MANGA_GROUP or Group in .manga not set")
-	}
 }
 
 func SaveConfig() {
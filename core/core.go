@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"ktkr.us/pkg/dn2/manga"
@@ -20,12 +22,134 @@ func (id Identifier) String() string {
 	return fmt.Sprintf("%s%02d", id.Kind, id.Ordinal)
 }
 
+// kindOrder is the order kinds of releases sort in. Other kinds sort after
+// them.
+var kindOrder = map[manga.ReleaseKind]int{
+	manga.Volume:  1,
+	manga.Chapter: 2,
+	manga.DramaCD: 3,
+}
+
+// Less reports whether id sorts before other: volumes, then chapters, then
+// drama CDs, each by number.
+func (id Identifier) Less(other Identifier) bool {
+	if id.Kind != other.Kind {
+		a, b := kindOrder[id.Kind], kindOrder[other.Kind]
+		if a == 0 || b == 0 {
+			return a != 0 || b == 0 && id.Kind < other.Kind
+		}
+		return a < b
+	}
+	return id.Ordinal < other.Ordinal
+}
+
+// ParseIdentifier parses an identifier such as v01, c12 or cd2.
+// TODO: how do we identify oneshots?
+func ParseIdentifier(s string) (Identifier, error) {
+	if len(s) < 2 {
+		return Identifier{}, fmt.Errorf("%s: invalid identifier", s)
+	}
+
+	n := strings.IndexFunc(s, func(ch rune) bool { return '0' <= ch && ch <= '9' })
+	if n == -1 {
+		return Identifier{}, fmt.Errorf("%s: invalid identifier", s)
+	}
+
+	ord, err := strconv.Atoi(s[n:])
+	if err != nil {
+		return Identifier{}, fmt.Errorf("%s: invalid identifier: %v", s, err)
+	}
+	id := Identifier{Ordinal: ord}
+
+	switch pre := s[:n]; pre {
+	case "v":
+		id.Kind = manga.Volume
+	case "c":
+		id.Kind = manga.Chapter
+	case "cd":
+		id.Kind = manga.DramaCD
+	default:
+		return Identifier{}, fmt.Errorf("%s: invalid kind specifier '%s' in identifier", s, pre)
+	}
+
+	return id, nil
+}
+
+// ParseRange parses an identifier or a range of identifiers of one kind, such
+// as v01-v05 or v01-05, and returns every identifier in it.
+func ParseRange(s string) ([]Identifier, error) {
+	i := strings.Index(s, "-")
+	if i == -1 {
+		id, err := ParseIdentifier(s)
+		if err != nil {
+			return nil, err
+		}
+		return []Identifier{id}, nil
+	}
+
+	first, err := ParseIdentifier(s[:i])
+	if err != nil {
+		return nil, err
+	}
+	last := s[i+1:]
+	if n, err := strconv.Atoi(last); err == nil {
+		last = fmt.Sprintf("%s%d", first.Kind, n)
+	}
+	end, err := ParseIdentifier(last)
+	if err != nil {
+		return nil, err
+	}
+	if end.Kind != first.Kind || end.Ordinal < first.Ordinal {
+		return nil, fmt.Errorf("%s: invalid range", s)
+	}
+
+	ids := make([]Identifier, 0, end.Ordinal-first.Ordinal+1)
+	for ord := first.Ordinal; ord <= end.Ordinal; ord++ {
+		ids = append(ids, Identifier{Kind: first.Kind, Ordinal: ord})
+	}
+	return ids, nil
+}
+
+// Identifiers returns the identifiers that have a directory in the series, in
+// directory order.
+func Identifiers() ([]Identifier, error) {
+	fis, err := ioutil.ReadDir(TopLevel())
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]Identifier, 0, len(fis))
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		if id, err := ParseIdentifier(fi.Name()); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
 var ROOT string
 
 // Get the top level of the manga directory
 func TopLevel() string {
+	wd, ok := findTopLevel()
+	if !ok {
+		log.Fatal("not in manga project (or any parent directories) - missing .manga")
+	}
+	return wd
+}
+
+// InProject reports whether the working directory is inside a manga project.
+func InProject() bool {
+	_, ok := findTopLevel()
+	return ok
+}
+
+func findTopLevel() (string, bool) {
 	if ROOT != "" {
-		return ROOT
+		return ROOT, true
 	}
 	wd, err := os.Getwd()
 	if err != nil {
@@ -35,16 +159,24 @@ func TopLevel() string {
 		_, err := os.Stat(filepath.Join(wd, ".manga"))
 		if err == nil {
 			ROOT = wd
-			return wd
+			return wd, true
 		}
 		newwd := filepath.Dir(wd)
 		if newwd == wd {
-			log.Fatal("not in manga project (or any parent directories) - missing .manga")
+			return "", false
 		}
 		wd = newwd
 	}
 }
 
+// DownloadURL returns the URL the download server serves an archive at.
+func DownloadURL(filename string) string {
+	return "http://" + Config.DLServ + "/" + url.PathEscape(filename)
+}
+
+// FirstArchive returns the first archive of id at the top level, named
+// "<Title> <id> [...].zip", possibly with extra words before the group. Batches
+// such as "<Title> v01-v05 [...].zip" and longer identifiers don't match.
 func FirstArchive(id Identifier) (os.FileInfo, error) {
 	fis, err := ioutil.ReadDir(TopLevel())
 	if err != nil {
@@ -55,7 +187,7 @@ func FirstArchive(id Identifier) (os.FileInfo, error) {
 
 	for _, fi := range fis {
 		name := fi.Name()
-		if strings.HasPrefix(name, zipName) && filepath.Ext(name) == ".zip" {
+		if strings.HasPrefix(name, zipName+" ") && filepath.Ext(name) == ".zip" {
 			return fi, nil
 		}
 	}
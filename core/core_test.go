@@ -0,0 +1,23 @@
+package core
+
+import "testing"
+
+func TestIdentifierLess(t *testing.T) {
+	// in order
+	ids := []string{"v01", "v02", "v10", "c01", "c03", "cd1"}
+	for i, a := range ids {
+		for j, b := range ids {
+			ia, err := ParseIdentifier(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ib, err := ParseIdentifier(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ia.Less(ib); got != (i < j) {
+				t.Errorf("%s.Less(%s) = %v", a, b, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Credit names the staff who did one job on a release.
+type Credit struct {
+	Role  string
+	Names []string
+}
+
+func (c *Credit) String() string {
+	return c.Role + ": " + strings.Join(c.Names, ", ")
+}
+
+// Credits returns the staff credits of id: the series roster in .manga, with
+// the roles listed in the file Credits in the identifier's directory
+// replacing or adding to it. Each line of Credits is written as
+//
+//	Role: Name, Name...
+//
+// A role with no names removes it from the roster for this release.
+func Credits(id Identifier) ([]*Credit, error) {
+	credits := make([]*Credit, 0, len(Config.Staff))
+	for _, c := range Config.Staff {
+		credits = append(credits, &Credit{Role: c.Role, Names: c.Names})
+	}
+
+	path := filepath.Join(TopLevel(), id.String(), "Credits")
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return credits, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		c, err := parseCredit(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		credits = setCredit(credits, c)
+	}
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+	return credits, nil
+}
+
+func parseCredit(line string) (*Credit, error) {
+	i := strings.Index(line, ":")
+	if i < 1 {
+		return nil, fmt.Errorf("malformed credit %q (want \"Role: Name, Name...\")", line)
+	}
+	c := &Credit{Role: strings.TrimSpace(line[:i])}
+	for _, name := range strings.Split(line[i+1:], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			c.Names = append(c.Names, name)
+		}
+	}
+	return c, nil
+}
+
+// setCredit replaces the credit for c's role in credits, or appends it if the
+// role isn't there yet. A credit with no names removes the role.
+func setCredit(credits []*Credit, c *Credit) []*Credit {
+	for i, old := range credits {
+		if strings.EqualFold(old.Role, c.Role) {
+			if len(c.Names) == 0 {
+				return append(credits[:i], credits[i+1:]...)
+			}
+			credits[i] = c
+			return credits
+		}
+	}
+	if len(c.Names) == 0 {
+		return credits
+	}
+	return append(credits, c)
+}
@@ -0,0 +1,56 @@
+package core
+
+// FormDest describes a site that takes releases as plain multipart form
+// uploads. Fields, Header and ReleaseURL are text/templates; see the README
+// for what they can refer to.
+type FormDest struct {
+	URL       string            // http or https endpoint
+	FileField string            `json:",omitempty"` // form field of the archive, default "file"
+	Fields    map[string]string `json:",omitempty"` // other form fields
+	Header    map[string]string `json:",omitempty"`
+
+	// The upload succeeded if the response has status Status (any 2xx if
+	// zero), its body matches OK if set and doesn't match Error if set. The
+	// first submatch of Error, if any, is the error message.
+	Status int    `json:",omitempty"`
+	OK     string `json:",omitempty"`
+	Error  string `json:",omitempty"`
+
+	ReleaseURL string `json:",omitempty"` // reported after upload
+	PerChapter bool   `json:",omitempty"` // upload a volume's chapter archives one by one
+}
+
+// MirrorDest describes a copy of all releases kept in a directory tree, as
+// <Title>/<identifier>/<file> under Dir, with an index of what is there.
+type MirrorDest struct {
+	Dir  string
+	Host string `json:",omitempty"` // reached over ssh if set, local otherwise
+}
+
+// TorrentConfig sets up the torrents made by manga torrent.
+type TorrentConfig struct {
+	Announce []string `json:",omitempty"` // tracker URLs, one tier each
+	WebSeeds []string `json:",omitempty"` // default: the download server, for single files
+}
+
+// Webhook is a URL notified after a release or news post is published.
+type Webhook struct {
+	URL     string
+	Events  []string          `json:",omitempty"` // "release", "news"; default both
+	Payload string            `json:",omitempty"` // text/template of the JSON body
+	Header  map[string]string `json:",omitempty"`
+	Retries int               `json:",omitempty"` // default 3
+}
+
+// Wants reports whether the webhook is to be notified of event.
+func (w *Webhook) Wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
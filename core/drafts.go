@@ -0,0 +1,69 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DraftDir is the folder at the top level of the series where news posts and
+// release notes are kept until they have been posted.
+const DraftDir = ".drafts"
+
+// Kinds of drafts.
+const (
+	NewsDraft    = "news"
+	ReleaseDraft = "release"
+)
+
+// DraftPath returns the path of the draft of the given kind and name.
+func DraftPath(kind, name string) string {
+	return filepath.Join(TopLevel(), DraftDir, kind, name+".md")
+}
+
+// Drafts returns the names of the drafts of the given kind, most recently
+// changed first.
+func Drafts(kind string) ([]string, error) {
+	fis, err := ioutil.ReadDir(filepath.Join(TopLevel(), DraftDir, kind))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(fis, func(i, j int) bool { return fis[i].ModTime().After(fis[j].ModTime()) })
+	var names []string
+	for _, fi := range fis {
+		if filepath.Ext(fi.Name()) == ".md" {
+			names = append(names, strings.TrimSuffix(fi.Name(), ".md"))
+		}
+	}
+	return names, nil
+}
+
+// SaveDraft writes the draft of the given kind and name.
+func SaveDraft(kind, name, text string) error {
+	path := DraftPath(kind, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return WriteFile(path, []byte(text), 0644)
+}
+
+// LoadDraft reads the draft of the given kind and name. If there is none, the
+// error satisfies os.IsNotExist.
+func LoadDraft(kind, name string) (string, error) {
+	buf, err := ioutil.ReadFile(DraftPath(kind, name))
+	return string(buf), err
+}
+
+// RemoveDraft removes the draft of the given kind and name, if any.
+func RemoveDraft(kind, name string) error {
+	err := os.Remove(DraftPath(kind, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
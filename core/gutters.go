@@ -0,0 +1,102 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GutterFile is the file in an identifier's directory listing where manga
+// prep splits each scan.
+const GutterFile = "Gutters"
+
+const gutterHeader = `# Where each scan is split into two pages, in percent of its width from the
+# left after rotating, followed by the scan's name. Change a number to split
+# the scan there next time; remove the line to look for the gutter again.
+`
+
+// GutterNotFound is the note on scans that were split in the middle for want
+// of a gutter. It is dropped from lines whose gutter has been moved since.
+const GutterNotFound = "gutter not found, split in the middle"
+
+// Gutter is where a scan is split into pages.
+type Gutter struct {
+	Percent float64 // from the left of the scan after rotating
+	Scan    string  // file name of the scan
+	Note    string  // written as a comment after it
+}
+
+func (g *Gutter) String() string {
+	s := fmt.Sprintf("%.1f\t%s", g.Percent, g.Scan)
+	if g.Note != "" {
+		s += "\t# " + g.Note
+	}
+	return s
+}
+
+// LoadGutters reads the gutters listed in the file at path, by scan name. If
+// there is no file, there are none.
+func LoadGutters(path string) (map[string]*Gutter, error) {
+	gutters := make(map[string]*Gutter)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return gutters, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	for n := 1; s.Scan(); n++ {
+		var note string
+		line := s.Text()
+		if i := commentIndex(line); i >= 0 {
+			line, note = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		p, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil || len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: malformed line (want \"<percent> <scan>\")", path, n)
+		}
+		if p <= 0 || p >= 100 {
+			return nil, fmt.Errorf("%s:%d: gutter at %v%% is outside the scan", path, n, p)
+		}
+		scan := strings.TrimSpace(line[len(fields[0]):])
+		if note == GutterNotFound && p != 50 {
+			note = ""
+		}
+		gutters[scan] = &Gutter{Percent: p, Scan: scan, Note: note}
+	}
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+	return gutters, nil
+}
+
+// commentIndex returns where the comment on line starts: the first # at the
+// start of the line or after a space, as scan names may have them too.
+func commentIndex(line string) int {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return i
+		}
+	}
+	return -1
+}
+
+// SaveGutters writes gutters to the file at path.
+func SaveGutters(path string, gutters []*Gutter) error {
+	lines := make([]string, len(gutters))
+	for i, g := range gutters {
+		lines[i] = g.String()
+	}
+	buf := gutterHeader + strings.Join(lines, "\n") + "\n"
+	return WriteFile(path, []byte(buf), 0644)
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeGutters(t *testing.T, text string) string {
+	path := filepath.Join(t.TempDir(), GutterFile)
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadGutters(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want map[string]*Gutter
+		err  string
+	}{
+		{
+			name: "lines",
+			text: gutterHeader + "48.5\t001.jpg\n" +
+				"  51 \t scan 002.jpg  \n" +
+				"\n" +
+				"# a comment\n" +
+				"50.0\tscan#3.jpg\t# " + GutterNotFound + "\n" +
+				"49 004.jpg # checked by hand\n",
+			want: map[string]*Gutter{
+				"001.jpg":      {Percent: 48.5, Scan: "001.jpg"},
+				"scan 002.jpg": {Percent: 51, Scan: "scan 002.jpg"},
+				"scan#3.jpg":   {Percent: 50, Scan: "scan#3.jpg", Note: GutterNotFound},
+				"004.jpg":      {Percent: 49, Scan: "004.jpg", Note: "checked by hand"},
+			},
+		},
+		{
+			// moving a gutter that wasn't found is enough to have it taken
+			// as found
+			name: "moved",
+			text: "47.5\t001.jpg\t# " + GutterNotFound + "\n",
+			want: map[string]*Gutter{"001.jpg": {Percent: 47.5, Scan: "001.jpg"}},
+		},
+		{name: "empty", text: gutterHeader, want: map[string]*Gutter{}},
+		{name: "no scan", text: "50\n", err: ":1: malformed line"},
+		{name: "no percent", text: gutterHeader + "001.jpg\n", err: ":4: malformed line"},
+		{name: "percent sign", text: "50% 001.jpg\n", err: ":1: malformed line"},
+		{name: "outside", text: "100 001.jpg\n", err: ":1: gutter at 100% is outside the scan"},
+		{name: "negative", text: "-3 001.jpg\n", err: ":1: gutter at -3% is outside the scan"},
+	}
+	for _, tt := range tests {
+		got, err := LoadGutters(writeGutters(t, tt.text))
+		switch {
+		case tt.err != "":
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want one with %q", tt.name, err, tt.err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case !reflect.DeepEqual(got, tt.want):
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	got, err := LoadGutters(filepath.Join(t.TempDir(), GutterFile))
+	if err != nil || len(got) != 0 {
+		t.Errorf("no file: got %v (%v), want no gutters", got, err)
+	}
+}
+
+func TestSaveGutters(t *testing.T) {
+	gutters := []*Gutter{
+		{Percent: 48.25, Scan: "001.jpg"},
+		{Percent: 50, Scan: "scan 002.jpg", Note: GutterNotFound},
+		{Percent: 52.5, Scan: "scan#3.jpg", Note: "checked"},
+	}
+	path := filepath.Join(t.TempDir(), GutterFile)
+	if err := SaveGutters(path, gutters); err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := gutterHeader +
+		"48.2\t001.jpg\n" +
+		"50.0\tscan 002.jpg\t# " + GutterNotFound + "\n" +
+		"52.5\tscan#3.jpg\t# checked\n"
+	if string(text) != want {
+		t.Errorf("wrote\n%s\nwant\n%s", text, want)
+	}
+
+	got, err := LoadGutters(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gutters[0].Percent = 48.2 // written to a tenth of a percent
+	for _, g := range gutters {
+		if !reflect.DeepEqual(got[g.Scan], g) {
+			t.Errorf("read back %v, want %v", got[g.Scan], g)
+		}
+	}
+	if len(got) != len(gutters) {
+		t.Errorf("read back %d gutters, want %d", len(got), len(gutters))
+	}
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewsDir is the folder at the top level of the series where published news
+// posts are recorded.
+const NewsDir = ".news"
+
+// NewsRecord is a news post as it was published.
+type NewsRecord struct {
+	Id      int
+	Title   string
+	Body    string
+	Tags    []string `json:",omitempty"`
+	Posted  time.Time
+	Updated time.Time `json:",omitempty"`
+}
+
+func newsPath(id int) string {
+	return filepath.Join(TopLevel(), NewsDir, strconv.Itoa(id)+".json")
+}
+
+// LoadNewsRecord reads the record of the news post with the given id. If
+// there is none, it returns nil.
+func LoadNewsRecord(id int) (*NewsRecord, error) {
+	buf, err := ioutil.ReadFile(newsPath(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	n := new(NewsRecord)
+	if err = json.Unmarshal(buf, n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// NewsRecords returns the records of all published news posts, newest first.
+func NewsRecords() ([]*NewsRecord, error) {
+	fis, err := ioutil.ReadDir(filepath.Join(TopLevel(), NewsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var records []*NewsRecord
+	for _, fi := range fis {
+		id, err := strconv.Atoi(strings.TrimSuffix(fi.Name(), ".json"))
+		if err != nil || filepath.Ext(fi.Name()) != ".json" {
+			continue
+		}
+		n, err := LoadNewsRecord(id)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, n)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Posted.After(records[j].Posted) })
+	return records, nil
+}
+
+// Save writes the record.
+func (n *NewsRecord) Save() error {
+	path := newsPath(n.Id)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	buf, err := json.MarshalIndent(n, "", "\t")
+	if err != nil {
+		return err
+	}
+	return WriteFile(path, buf, 0644)
+}
+
+// RemoveNewsRecord removes the record of the news post with the given id, if
+// any.
+func RemoveNewsRecord(id int) error {
+	err := os.Remove(newsPath(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Manifest records what has been released for an identifier. It is kept in
+// the file .release in the identifier's directory.
+type Manifest struct {
+	Id       int    `json:",omitempty"` // displaynone release id
+	Filename string `json:",omitempty"`
+	Filesize int64  `json:",omitempty"`
+	Shake256 string `json:",omitempty"`
+	Notes    string `json:",omitempty"`
+	Uploaded time.Time
+
+	Draft     bool      `json:",omitempty"`
+	PublishAt time.Time // zero if published on upload
+
+	// Outcome of the last attempt to publish to each destination.
+	Destinations map[string]*DestStatus `json:",omitempty"`
+}
+
+// DestStatus is the outcome of publishing a release to one destination.
+type DestStatus struct {
+	OK    bool
+	URL   string `json:",omitempty"`
+	Error string `json:",omitempty"`
+	Time  time.Time
+}
+
+// Pending reports whether the release has been uploaded but isn't public yet.
+func (m *Manifest) Pending() bool {
+	return m.Id != 0 && (m.Draft || m.PublishAt.After(time.Now()))
+}
+
+func manifestPath(id Identifier) string {
+	return filepath.Join(TopLevel(), id.String(), ".release")
+}
+
+// LoadManifest reads the release manifest of id. If nothing has been released
+// for id yet, an empty manifest is returned.
+func LoadManifest(id Identifier) (*Manifest, error) {
+	m := new(Manifest)
+	file, err := os.Open(manifestPath(id))
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err = json.NewDecoder(file).Decode(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Save writes the release manifest of id.
+func (m *Manifest) Save(id Identifier) error {
+	path := manifestPath(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	buf, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return WriteFile(path, buf, 0644)
+}
+
+// RemoveManifest deletes the release manifest of id.
+func RemoveManifest(id Identifier) error {
+	err := os.Remove(manifestPath(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
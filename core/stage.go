@@ -0,0 +1,102 @@
+package core
+
+import "path/filepath"
+
+// Stage is one of the working folders inside each identifier directory, e.g.
+// raw scans or finished, resized pages.
+type Stage struct {
+	Name string
+	Dir  string `json:",omitempty"` // folder name, defaults to Name
+}
+
+func (s Stage) dir() string {
+	if s.Dir == "" {
+		return s.Name
+	}
+	return s.Dir
+}
+
+// StageIO names the stages a subcommand reads from and writes to.
+type StageIO struct {
+	In  string `json:",omitempty"`
+	Out string `json:",omitempty"`
+}
+
+// DefaultStages is the layout used when .manga doesn't list any stages.
+var DefaultStages = []Stage{
+	{Name: "raw"},
+	{Name: "pages"},
+	{Name: "psd"},
+	{Name: "res"},
+	{Name: "out"},
+}
+
+// Stages returns the stage layout of the current series in workflow order.
+func Stages() []Stage {
+	if len(Config.Stages) == 0 {
+		return DefaultStages
+	}
+	return Config.Stages
+}
+
+// StageDir returns the folder name of the named stage. If .manga doesn't list
+// the stage, the closest stage listed before it in the default layout stands
+// in for it, or failing that the identifier's folder itself ("").
+func StageDir(name string) string {
+	stages := Stages()
+	if dir, ok := stageDir(stages, name); ok {
+		return dir
+	}
+	prev := ""
+	for _, s := range DefaultStages {
+		if s.Name == name {
+			return prev
+		}
+		if dir, ok := stageDir(stages, s.Name); ok {
+			prev = dir
+		}
+	}
+	return ""
+}
+
+func stageDir(stages []Stage, name string) (string, bool) {
+	for _, s := range stages {
+		if s.Name == name {
+			return s.dir(), true
+		}
+	}
+	return "", false
+}
+
+// StageBefore returns the name of the stage listed before the named one.
+func StageBefore(name string) (string, bool) {
+	stages := Stages()
+	for i, s := range stages {
+		if s.Name == name && i > 0 {
+			return stages[i-1].Name, true
+		}
+	}
+	return "", false
+}
+
+// StagePath returns the path of the named stage's folder for id, relative to
+// the top level.
+func StagePath(id Identifier, name string) string {
+	return filepath.Join(id.String(), StageDir(name))
+}
+
+// CommandStages returns the stages the named subcommand should use. Entries
+// in the Pipeline section of .manga override the subcommand's defaults.
+func CommandStages(cmd string, def StageIO) StageIO {
+	stages, ok := Config.Pipeline[cmd]
+	if !ok {
+		return def
+	}
+	if stages.In == "" {
+		stages.In = def.In
+	}
+	if stages.Out == "" {
+		stages.Out = def.Out
+	}
+	return stages
+}
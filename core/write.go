@@ -0,0 +1,54 @@
+package core
+
+import (
+	"io"
+	"os"
+)
+
+// A RenameFS is somewhere files can be created and renamed, such as a mirror.
+type RenameFS interface {
+	Create(name string) (io.WriteCloser, error)
+	Rename(oldname, newname string) error
+}
+
+// WriteFileFS writes data to name in fs by way of a temporary file next to it,
+// so a failed write leaves the file as it was.
+func WriteFileFS(fs RenameFS, name string, data []byte) error {
+	tmp := name + ".tmp"
+	w, err := fs.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return fs.Rename(tmp, name)
+}
+
+// WriteFile is WriteFileFS on the local filesystem. The file gets mode perm
+// even if it already exists.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	return WriteFileFS(permFS(perm), path, data)
+}
+
+type permFS os.FileMode
+
+func (perm permFS) Create(name string) (io.WriteCloser, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(perm))
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Chmod(os.FileMode(perm)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (permFS) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"ktkr.us/pkg/dn2/manga"
+
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/util"
+)
+
+var cmdCover = &Command{
+	Name:    "cover",
+	Summary: "[-p <page>] [-f] <identifier>",
+	Help: `
+Make the cover and thumbnail images posted with a release from the first page
+of the identifier, or the page named with -p. They are written to the top
+level of the series as <Shortname>-<identifier>.jpg and
+<Shortname>-<identifier>-thumb.jpg. Their heights and JPEG quality are set by
+CoverHeight, ThumbHeight and CoverQuality in .manga.
+
+"manga up" makes them the same way if they don't exist yet.`,
+	Flags:  flag.NewFlagSet("cover", flag.ExitOnError),
+	Stages: core.StageIO{In: "out"},
+}
+
+var (
+	coverP = cmdCover.Flags.String("p", "", "Make the cover from `\033[4mPAGE\033[m` instead of the first page")
+	coverF = cmdCover.Flags.Bool("f", false, "Overwrite existing images")
+)
+
+const (
+	defaultCoverHeight  = 1200
+	defaultThumbHeight  = 300
+	defaultCoverQuality = 90
+)
+
+func init() {
+	cmdCover.Run = runCover
+}
+
+func runCover(cmd *Command, args []string) {
+	if len(args) == 0 {
+		help(cmd)
+	}
+
+	core.LoadConfig()
+	id := cmd.identifier(args[0])
+	if id.Kind == manga.Chapter {
+		cmd.Fatal("chapters don't have covers")
+	}
+
+	cover, thumb := coverPaths(id)
+	if !*coverF {
+		for _, name := range []string{cover, thumb} {
+			if _, err := os.Stat(name); err == nil {
+				cmd.Fatalf("%s already exists (use -f to overwrite)", name)
+			}
+		}
+	}
+
+	makeCovers(cmd, id, *coverP)
+}
+
+// coverPaths returns the paths of the cover and thumbnail images of id.
+func coverPaths(id core.Identifier) (cover, thumb string) {
+	cover = util.Rooted(fmt.Sprintf("%s-%s.jpg", core.Config.Shortname, id))
+	thumb = util.Rooted(fmt.Sprintf("%s-%s-thumb.jpg", core.Config.Shortname, id))
+	return
+}
+
+// coverFiles returns the cover and thumbnail images to post with a release.
+// Chapters don't have any.
+func coverFiles(id core.Identifier) map[string]string {
+	files := make(map[string]string)
+
+	if id.Kind != manga.Chapter {
+		files["cover"], files["thumb"] = coverPaths(id)
+	}
+	return files
+}
+
+func coverHeights() (cover, thumb int) {
+	cover, thumb = core.Config.CoverHeight, core.Config.ThumbHeight
+	if cover <= 0 {
+		cover = defaultCoverHeight
+	}
+	if thumb <= 0 {
+		thumb = defaultThumbHeight
+	}
+	return
+}
+
+// makeCovers writes the cover and thumbnail of id, made from the named page
+// in cmd's input stage, or from the first page if page is empty.
+func makeCovers(cmd *Command, id core.Identifier, page string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+	os.Chdir(core.TopLevel())
+	ims := cmdCover.inImages(id.String(), Page, Spread)
+	os.Chdir(wd)
+
+	if len(ims) == 0 {
+		cmd.Fatalf("%v: no pages to make a cover from", id)
+	}
+	src := ims[0]
+	if page != "" {
+		src = nil
+		for _, im := range ims {
+			if im.name() == page || im.base() == page {
+				src = im
+				break
+			}
+		}
+		if src == nil {
+			cmd.Fatalf("%v: no such page %s", id, page)
+		}
+	}
+
+	quality := core.Config.CoverQuality
+	if quality <= 0 {
+		quality = defaultCoverQuality
+	}
+	coverH, thumbH := coverHeights()
+	cover, thumb := coverPaths(id)
+
+	cmd.Printf("making cover and thumbnail from %s", src.base())
+	for _, out := range []struct {
+		path   string
+		height int
+	}{{cover, coverH}, {thumb, thumbH}} {
+		src.convert(
+			"-colorspace", "RGB",
+			"-resize", fmt.Sprintf("x%d", out.height),
+			"-colorspace", "sRGB",
+			"-strip",
+			"-quality", strconv.Itoa(quality),
+			out.path,
+		)
+	}
+}
+
+// checkCovers makes sure the cover and thumbnail of id exist, making them from
+// the first page if they don't. Existing ones that don't have the configured
+// heights, such as covers made before the heights were, are only reported.
+func checkCovers(cmd *Command, id core.Identifier) error {
+	if id.Kind == manga.Chapter {
+		return nil
+	}
+
+	cover, thumb := coverPaths(id)
+	for _, name := range []string{cover, thumb} {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			makeCovers(cmd, id, "")
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	if *globalDryRun {
+		return nil
+	}
+
+	coverH, thumbH := coverHeights()
+	for _, c := range []struct {
+		path   string
+		height int
+	}{{cover, coverH}, {thumb, thumbH}} {
+		im := &Image{Path: c.path}
+		if _, h := im.size(); h != c.height {
+			cmd.Printf("%s is %dpx high, not %dpx (remake it with manga cover -f if that's wrong)", im.base(), h, c.height)
+		}
+	}
+	return nil
+}
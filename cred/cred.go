@@ -0,0 +1,113 @@
+// Package cred stores logins and session cookies for remote accounts in a
+// file that only the user can read.
+package cred
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"ktkr.us/pkg/manga/core"
+)
+
+// Account is the stored login for one remote site.
+type Account struct {
+	Username string         `json:",omitempty"`
+	Password string         `json:",omitempty"`
+	Token    string         `json:",omitempty"` // API token, if the site uses one
+	Cookies  []*http.Cookie `json:",omitempty"` // last session
+}
+
+// Live returns the stored session cookies that haven't expired yet.
+func (a *Account) Live() []*http.Cookie {
+	now := time.Now()
+	live := make([]*http.Cookie, 0, len(a.Cookies))
+	for _, c := range a.Cookies {
+		if c.Expires.IsZero() || c.Expires.After(now) {
+			live = append(live, c)
+		}
+	}
+	return live
+}
+
+// Store maps site names to accounts.
+type Store map[string]*Account
+
+// Path returns the location of the credentials file: $MANGA_CREDENTIALS, or
+// manga/credentials in the user's config directory.
+func Path() (string, error) {
+	if path := os.Getenv("MANGA_CREDENTIALS"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "manga", "credentials"), nil
+}
+
+// Load reads the credentials file. A missing file yields an empty store. The
+// file is rejected if anyone but its owner can access it, except on Windows,
+// where the permission bits don't tell and access is left to the ACLs of the
+// user's profile.
+func Load() (Store, error) {
+	s := make(Store)
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%s: permissions %v are too open (chmod 600 it)", path, fi.Mode().Perm())
+	}
+
+	if err = json.NewDecoder(file).Decode(&s); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return s, nil
+}
+
+// Account returns the stored account for site, creating an empty one if
+// there is none.
+func (s Store) Account(site string) *Account {
+	a, ok := s[site]
+	if !ok {
+		a = new(Account)
+		s[site] = a
+	}
+	return a
+}
+
+// Save writes the store back to the credentials file, readable only by the
+// user.
+func (s Store) Save() error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	buf, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	return core.WriteFile(path, buf, 0600)
+}
@@ -1,19 +1,24 @@
+// Package dn is a client for the displaynone API.
 package dn
 
 import (
+	"bytes"
 	"encoding/ascii85"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
-	"log"
 	"mime/multipart"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/cred"
 	"ktkr.us/pkg/manga/util"
 
 	"ktkr.us/pkg/dn2/manga"
@@ -24,92 +29,432 @@ import (
 const (
 	uploadPath = "/upload"
 	hashSize   = 64
+
+	// CredSite is the name of the displaynone account in the credential
+	// store.
+	CredSite = "displaynone"
 )
 
 var hashEncSize = ascii85.MaxEncodedLen(hashSize)
 
-func UploadFile(filePath string) (*http.Response, error) {
+// Release is a release as sent to and returned by the server.
+type Release struct {
+	manga.Release
+
+	// Drafts are only visible to staff until published. A release with a
+	// publish time in the future is published by the server at that time.
+	Draft     bool       `json:",omitempty"`
+	PublishAt *time.Time `json:",omitempty"`
+}
+
+// NewsPost is a news post as sent to and returned by the server.
+type NewsPost struct {
+	manga.NewsPost
+
+	Tags []string `json:",omitempty"`
+
+	// A post with a publish time in the future is published by the server
+	// at that time.
+	PublishAt *time.Time `json:",omitempty"`
+}
+
+// Series is a series as returned by the server.
+type Series struct {
+	Id        int
+	Title     string
+	Shortname string
+}
+
+// Upload describes an archive uploaded to the download server.
+type Upload struct {
+	Name     string
+	Size     util.Bytes
+	Shake256 string
+}
+
+// Error is an error response from the server.
+type Error struct {
+	Status string `json:"-"`
+	Msg    string
+	Err    string
+}
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if e.Err != "" {
+		if msg != "" {
+			msg += ": "
+		}
+		msg += e.Err
+	}
+	if msg == "" {
+		return e.Status
+	}
+	return e.Status + ": " + msg
+}
+
+// UnmarshalJSON accepts both the {Msg, Err} and the {Error} forms the server
+// responds with.
+func (e *Error) UnmarshalJSON(b []byte) error {
+	var v struct{ Msg, Err, Error string }
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	e.Msg = v.Msg
+	e.Err = v.Err
+	if e.Err == "" {
+		e.Err = v.Error
+	}
+	return nil
+}
+
+// Client talks to the displaynone API server and its download server.
+type Client struct {
+	BaseURL string // API server, e.g. http://example.com
+	DLServ  string // download server, host[:port]
+	Token   string // sent as a bearer token if set
+
+	// HTTPClient is used for all requests. Archive and cover uploads stream
+	// through it with progress reporting.
+	HTTPClient *http.Client
+}
+
+// NewClient makes a client for the API server at remote and the download
+// server at dlserv, authenticating with token. remote may omit the scheme.
+func NewClient(remote, dlserv, token string) *Client {
+	if !strings.Contains(remote, "://") {
+		remote = "http://" + remote
+	}
+	return &Client{
+		BaseURL:    strings.TrimSuffix(remote, "/"),
+		DLServ:     dlserv,
+		Token:      token,
+		HTTPClient: &http.Client{Transport: transport},
+	}
+}
+
+// transport gives up on servers that don't answer in time, but not on uploads
+// that take long to send.
+var transport = func() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ResponseHeaderTimeout = 30 * time.Second
+	return t
+}()
+
+// Default makes a client for the current series' remote. The token is taken
+// from $MANGA_TOKEN or from the credential store.
+func Default() (*Client, error) {
+	if core.Config.Remote == "" {
+		return nil, fmt.Errorf("displaynone remote url not set")
+	}
+
+	token := os.Getenv("MANGA_TOKEN")
+	if token == "" {
+		store, err := cred.Load()
+		if err != nil {
+			return nil, err
+		}
+		if a, ok := store[CredSite]; ok {
+			token = a.Token
+		}
+	}
+	return NewClient(core.Config.Remote, core.Config.DLServ, token), nil
+}
+
+// request makes a request to url with the client's token.
+func (c *Client) request(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.header() {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// header returns the header fields that go with every request.
+func (c *Client) header() map[string]string {
+	if c.Token == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + c.Token}
+}
+
+// dlservURL returns the base URL of the download server.
+func (c *Client) dlservURL() string {
+	if strings.Contains(c.DLServ, "://") {
+		return strings.TrimSuffix(c.DLServ, "/")
+	}
+	return "http://" + c.DLServ
+}
+
+// do makes a JSON request to the API server. body, if not nil, is encoded as
+// the request body, and a response with status want is decoded into v.
+func (c *Client) do(method, path string, body interface{}, want int, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		buf := new(bytes.Buffer)
+		if err := json.NewEncoder(buf).Encode(body); err != nil {
+			return err
+		}
+		r = buf
+	}
+
+	req, err := c.request(method, c.BaseURL+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	return decode(resp, want, v)
+}
+
+// decode checks that resp has status want and decodes its body into v, or
+// returns the server's error.
+func decode(resp *http.Response, want int, v interface{}) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != want {
+		e := &Error{Status: resp.Status}
+		json.NewDecoder(resp.Body).Decode(e)
+		return e
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decoding response: %v", err)
+	}
+	return nil
+}
+
+// Upload uploads the archive at filePath to the download server along with
+// its SHAKE256 hash. Progress is sent to p, or printed if p is nil.
+func (c *Client) Upload(filePath string, p chan string) (*Upload, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
+
 	fi, err := f.Stat()
 	if err != nil {
 		return nil, err
 	}
 
-	shake := sha3.NewShake256()
-	_, err = io.Copy(shake, f)
+	sum, err := Shake256(f)
 	if err != nil {
 		return nil, err
 	}
 	f.Seek(0, os.SEEK_SET)
 
-	h := make([]byte, hashSize)
-	shake.Read(h)
-	buf := base64.URLEncoding.EncodeToString(h)
-
 	q := url.Values{}
 	q.Add("Name", fi.Name())
-	q.Add("Shake256", url.QueryEscape(string(buf)))
+	q.Add("Shake256", url.QueryEscape(sum))
 	path := uploadPath + "?" + q.Encode()
 
-	return util.UploadFileProgress(core.Config.DLServ, path, f, nil, util.Bytes(fi.Size()), nil, nil)
+	resp, err := util.UploadFileProgress(c.HTTPClient, c.dlservURL()+path, f, nil, util.Bytes(fi.Size()), c.header(), p)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &Upload{Name: fi.Name(), Size: util.Bytes(fi.Size()), Shake256: sum}
+	if err = decode(resp, http.StatusCreated, nil); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Shake256 returns the base64 encoded 64 byte SHAKE256 hash of r's contents,
+// as the download server expects it.
+func Shake256(r io.Reader) (string, error) {
+	shake := sha3.NewShake256()
+	if _, err := io.Copy(shake, r); err != nil {
+		return "", err
+	}
+
+	h := make([]byte, hashSize)
+	shake.Read(h)
+	return base64.URLEncoding.EncodeToString(h), nil
 }
 
-func PostForm(hostPort, reqPath string, files map[string]string, r *manga.Release) (*http.Response, error) {
-	// add :http to the host string if it isn't there
-	host, _, err := net.SplitHostPort(hostPort)
-	if err != nil {
-		host = net.JoinHostPort(hostPort, "http")
-	} else {
-		host = hostPort
+// CreateRelease posts a new release. files maps form fields (cover, thumb) to
+// the paths of the images to send along with it.
+func (c *Client) CreateRelease(r *Release, files map[string]string) (*Release, error) {
+	created := new(Release)
+	if err := c.postForm("/release/create", files, r, http.StatusCreated, created); err != nil {
+		return nil, err
 	}
-	log.Print("remote host: ", host)
+	return created, nil
+}
 
-	formReader, formWriter := io.Pipe()
-	form := multipart.NewWriter(formWriter)
+// UpdateRelease replaces the metadata of the release with r's Id, and the
+// cover or thumbnail if given in files.
+func (c *Client) UpdateRelease(r *Release, files map[string]string) (*Release, error) {
+	updated := new(Release)
+	if err := c.postForm("/release/update", files, r, http.StatusOK, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
 
-	var totalSize util.Bytes
+// Release returns the release with the given id.
+func (c *Client) Release(id int) (*Release, error) {
+	r := new(Release)
+	if err := c.do("GET", "/release/"+strconv.Itoa(id), nil, http.StatusOK, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
 
-	if files != nil {
-		for _, filename := range files {
-			fi, err := os.Stat(filename)
-			if err != nil {
-				log.Fatalf("postForm: %v", err)
-			}
-			totalSize += util.Bytes(fi.Size())
-		}
+// DeleteRelease deletes the release with the given id.
+func (c *Client) DeleteRelease(id int) error {
+	body := struct{ Id int }{id}
+	return c.do("POST", "/release/delete", body, http.StatusOK, nil)
+}
+
+// PublishRelease publishes the draft or scheduled release with the given id
+// immediately.
+func (c *Client) PublishRelease(id int) (*Release, error) {
+	r := new(Release)
+	body := struct{ Id int }{id}
+	if err := c.do("POST", "/release/publish", body, http.StatusOK, r); err != nil {
+		return nil, err
 	}
+	return r, nil
+}
 
-	go func() {
-		defer formWriter.CloseWithError(io.EOF)
-		defer form.Close()
-		w, err := form.CreateFormField("data")
+// ListReleases returns all releases of the series with id seriesID.
+func (c *Client) ListReleases(seriesID int) ([]*Release, error) {
+	var rs []*Release
+	path := "/releases?series=" + strconv.Itoa(seriesID)
+	if err := c.do("GET", path, nil, http.StatusOK, &rs); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Series returns the series with the given id.
+func (c *Client) Series(id int) (*Series, error) {
+	s := new(Series)
+	if err := c.do("GET", "/series/"+strconv.Itoa(id), nil, http.StatusOK, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LatestNews returns the most recent news post.
+func (c *Client) LatestNews() (*NewsPost, error) {
+	n := new(NewsPost)
+	if err := c.do("GET", "/news", nil, http.StatusOK, n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// News returns the news post with the given id.
+func (c *Client) News(id int) (*NewsPost, error) {
+	n := new(NewsPost)
+	if err := c.do("GET", "/news/"+strconv.Itoa(id), nil, http.StatusOK, n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// ListNews returns all news posts, newest first.
+func (c *Client) ListNews() ([]*NewsPost, error) {
+	var ns []*NewsPost
+	if err := c.do("GET", "/news/list", nil, http.StatusOK, &ns); err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+// DeleteNews deletes the news post with the given id.
+func (c *Client) DeleteNews(id int) error {
+	body := struct{ Id int }{id}
+	return c.do("POST", "/news/delete", body, http.StatusOK, nil)
+}
+
+// CreateNews posts a new news post.
+func (c *Client) CreateNews(n *NewsPost) (*NewsPost, error) {
+	created := new(NewsPost)
+	if err := c.do("POST", "/news/create", n, http.StatusCreated, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateNews replaces the news post with n's Id.
+func (c *Client) UpdateNews(n *NewsPost) (*NewsPost, error) {
+	updated := new(NewsPost)
+	if err := c.do("POST", "/news/update", n, http.StatusOK, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// postForm sends data as JSON in the form field "data" along with files,
+// showing upload progress.
+func (c *Client) postForm(reqPath string, files map[string]string, data interface{}, want int, v interface{}) error {
+	var totalSize util.Bytes
+	for _, filename := range files {
+		fi, err := os.Stat(filename)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
+		totalSize += util.Bytes(fi.Size())
+	}
 
-		if err = json.NewEncoder(w).Encode(r); err != nil {
-			log.Fatal(err)
-		}
+	formReader, formWriter := io.Pipe()
+	form := multipart.NewWriter(formWriter)
 
-		if files != nil {
-			for field, filename := range files {
-				file, err := os.Open(filename)
-				if err != nil {
-					log.Fatalf("postForm: %v", err)
-				}
-				defer file.Close()
-
-				w, err := form.CreateFormFile(field, filepath.Base(filename))
-				if err != nil {
-					log.Fatalf("postForm: %v", err)
-				}
-				io.Copy(w, file)
-			}
-		}
+	go func() {
+		formWriter.CloseWithError(writeForm(form, files, data))
 	}()
 
-	return util.UploadFileProgress(host, reqPath, formReader, form, totalSize, nil, nil)
+	resp, err := util.UploadFileProgress(c.HTTPClient, c.BaseURL+reqPath, formReader, form, totalSize, c.header(), nil)
+	if err != nil {
+		return err
+	}
+	return decode(resp, want, v)
+}
+
+func writeForm(form *multipart.Writer, files map[string]string, data interface{}) error {
+	w, err := form.CreateFormField("data")
+	if err != nil {
+		return err
+	}
+	if err = json.NewEncoder(w).Encode(data); err != nil {
+		return err
+	}
+
+	for field, filename := range files {
+		if err = writeFormFile(form, field, filename); err != nil {
+			return err
+		}
+	}
+	return form.Close()
+}
+
+func writeFormFile(form *multipart.Writer, field, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w, err := form.CreateFormFile(field, filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, file)
+	return err
 }
@@ -0,0 +1,167 @@
+package dn_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ktkr.us/pkg/dn2/manga"
+
+	"ktkr.us/pkg/manga/dn"
+	"ktkr.us/pkg/manga/dn/dntest"
+)
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCreateRelease(t *testing.T) {
+	s := dntest.NewServer()
+	defer s.Close()
+	s.Token = "secret"
+	c := s.Client()
+
+	cover := writeFile(t, "cover.jpg", []byte("cover image"))
+	thumb := writeFile(t, "thumb.jpg", []byte("thumbnail"))
+	r := &dn.Release{Release: manga.Release{SeriesId: 3, Kind: manga.Volume, Ordinal: 2, Notes: "notes"}}
+
+	created, err := c.CreateRelease(r, map[string]string{"cover": cover, "thumb": thumb})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Id == 0 || created.SeriesId != 3 || created.Ordinal != 2 || created.Notes != "notes" {
+		t.Errorf("created %+v", created.Release)
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	if got := string(s.Files["cover"]); got != "cover image" {
+		t.Errorf("cover = %q", got)
+	}
+	if got := string(s.Files["thumb"]); got != "thumbnail" {
+		t.Errorf("thumb = %q", got)
+	}
+	if _, ok := s.Releases[created.Id]; !ok {
+		t.Errorf("release %d not stored", created.Id)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	s := dntest.NewServer()
+	defer s.Close()
+	s.Token = "secret"
+	c := s.Client()
+
+	// enough to take several writes, and a hash whose base64 needs escaping
+	data := bytes.Repeat([]byte("manga archive contents\n"), 50000)
+	path := writeFile(t, "Title v01 [G].zip", data)
+
+	p := make(chan string)
+	go func() {
+		for range p {
+		}
+	}()
+	u, err := c.Upload(path, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := dn.Shake256(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Shake256 != want || int(u.Size) != len(data) {
+		t.Errorf("upload = %+v, want hash %s and size %d", u, want, len(data))
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	got, ok := s.Uploads["Title v01 [G].zip"]
+	if !ok {
+		t.Fatal("server has no upload")
+	}
+	if got.Shake256 != want || int(got.Size) != len(data) {
+		t.Errorf("server got %+v, want hash %s and size %d", got, want, len(data))
+	}
+}
+
+func TestListReleases(t *testing.T) {
+	s := dntest.NewServer()
+	defer s.Close()
+	c := s.Client()
+
+	s.Releases[1] = &dn.Release{Release: manga.Release{Id: 1, SeriesId: 7, Kind: manga.Volume, Ordinal: 1}}
+	s.Releases[2] = &dn.Release{Release: manga.Release{Id: 2, SeriesId: 8, Kind: manga.Volume, Ordinal: 1}}
+	s.Releases[3] = &dn.Release{Release: manga.Release{Id: 3, SeriesId: 7, Kind: manga.Chapter, Ordinal: 4}, Draft: true}
+
+	rs, err := c.ListReleases(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 || rs[0].Id != 1 || rs[1].Id != 3 {
+		t.Fatalf("got %d releases: %+v", len(rs), rs)
+	}
+	if rs[0].Draft || !rs[1].Draft || rs[1].Kind != manga.Chapter {
+		t.Errorf("releases decoded as %+v and %+v", rs[0], rs[1])
+	}
+
+	rs, err = c.ListReleases(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 0 {
+		t.Errorf("got %d releases of a series without any", len(rs))
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := dntest.NewServer()
+	defer s.Close()
+	s.Token = "secret"
+
+	tests := []struct {
+		name   string
+		client *dn.Client
+		status int
+		msg    string
+	}{
+		// {Error} from the auth layer
+		{"bad token", dn.NewClient(s.URL, "", "wrong"), http.StatusUnauthorized, "bad token"},
+		// {Msg, Err} from the handlers
+		{"not found", s.Client(), http.StatusNotFound, "Not Found: no such release"},
+	}
+	for _, tt := range tests {
+		_, err := tt.client.Release(42)
+		e, ok := err.(*dn.Error)
+		if !ok {
+			t.Errorf("%s: got %v (%T), want *dn.Error", tt.name, err, err)
+			continue
+		}
+		if want := fmt.Sprintf("%d %s", tt.status, http.StatusText(tt.status)); e.Status != want {
+			t.Errorf("%s: status %q, want %q", tt.name, e.Status, want)
+		}
+		if want := e.Status + ": " + tt.msg; e.Error() != want {
+			t.Errorf("%s: error %q, want %q", tt.name, e.Error(), want)
+		}
+	}
+
+	// uploads are refused the same way
+	path := writeFile(t, "a.zip", []byte("zip"))
+	c := dn.NewClient(s.URL, strings.TrimPrefix(s.URL, "http://"), "wrong")
+	p := make(chan string)
+	go func() {
+		for range p {
+		}
+	}()
+	if _, err := c.Upload(path, p); err == nil || !strings.Contains(err.Error(), "bad token") {
+		t.Errorf("upload with a bad token: %v", err)
+	}
+}
@@ -0,0 +1,370 @@
+// Package dntest provides an in-memory displaynone server for tests.
+package dntest
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ktkr.us/pkg/manga/dn"
+	"ktkr.us/pkg/manga/util"
+)
+
+// Server is a fake displaynone API and download server. Its fields may be
+// inspected and modified between requests while holding Mu.
+type Server struct {
+	*httptest.Server
+
+	Token string // required bearer token; any request is accepted if empty
+
+	Mu       sync.Mutex
+	Series   map[int]*dn.Series
+	Releases map[int]*dn.Release
+	News     map[int]*dn.NewsPost
+	Uploads  map[string]*dn.Upload
+	Files    map[string][]byte // form files received with releases, by field
+	nextID   int
+}
+
+// NewServer starts a fake server. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		Series:   make(map[int]*dn.Series),
+		Releases: make(map[int]*dn.Release),
+		News:     make(map[int]*dn.NewsPost),
+		Uploads:  make(map[string]*dn.Upload),
+		Files:    make(map[string][]byte),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload", s.upload)
+	mux.HandleFunc("/release/create", s.releaseCreate)
+	mux.HandleFunc("/release/update", s.releaseUpdate)
+	mux.HandleFunc("/release/delete", s.releaseDelete)
+	mux.HandleFunc("/release/publish", s.releasePublish)
+	mux.HandleFunc("/release/", s.release)
+	mux.HandleFunc("/releases", s.releases)
+	mux.HandleFunc("/series/", s.series)
+	mux.HandleFunc("/news", s.latestNews)
+	mux.HandleFunc("/news/create", s.newsCreate)
+	mux.HandleFunc("/news/update", s.newsUpdate)
+	mux.HandleFunc("/news/delete", s.newsDelete)
+	mux.HandleFunc("/news/list", s.newsList)
+	mux.HandleFunc("/news/", s.newsPost)
+
+	s.Server = httptest.NewServer(s.auth(mux))
+	return s
+}
+
+// Client returns a client for s, using s.Token.
+func (s *Server) Client() *dn.Client {
+	u, _ := url.Parse(s.URL)
+	return dn.NewClient(s.URL, u.Host, s.Token)
+}
+
+func (s *Server) auth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+			// the server's auth layer answers in the other error form
+			reply(w, http.StatusUnauthorized, struct{ Error string }{"bad token"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) id() int {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("Name")
+	if name == "" {
+		fail(w, http.StatusBadRequest, "missing Name")
+		return
+	}
+
+	sum, err := dn.Shake256(r.Body)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// the client escapes the hash once more before adding it to the query
+	want, _ := url.QueryUnescape(r.FormValue("Shake256"))
+	if sum != want {
+		fail(w, http.StatusBadRequest, "hash mismatch")
+		return
+	}
+
+	s.Mu.Lock()
+	s.Uploads[name] = &dn.Upload{Name: name, Size: util.Bytes(r.ContentLength), Shake256: sum}
+	s.Mu.Unlock()
+	w.WriteHeader(http.StatusCreated)
+}
+
+// readRelease reads the release and files of a multipart release form.
+func (s *Server) readRelease(w http.ResponseWriter, r *http.Request) *dn.Release {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	rel := new(dn.Release)
+	if err := json.Unmarshal([]byte(r.FormValue("data")), rel); err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+
+	for field, fhs := range r.MultipartForm.File {
+		f, err := fhs[0].Open()
+		if err != nil {
+			fail(w, http.StatusBadRequest, err.Error())
+			return nil
+		}
+		buf, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			fail(w, http.StatusBadRequest, err.Error())
+			return nil
+		}
+		s.Files[field] = buf
+	}
+	return rel
+}
+
+func (s *Server) releaseCreate(w http.ResponseWriter, r *http.Request) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	rel := s.readRelease(w, r)
+	if rel == nil {
+		return
+	}
+	rel.Id = s.id()
+	s.Releases[rel.Id] = rel
+	reply(w, http.StatusCreated, rel)
+}
+
+func (s *Server) releaseUpdate(w http.ResponseWriter, r *http.Request) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	rel := s.readRelease(w, r)
+	if rel == nil {
+		return
+	}
+	if _, ok := s.Releases[rel.Id]; !ok {
+		fail(w, http.StatusNotFound, "no such release")
+		return
+	}
+	s.Releases[rel.Id] = rel
+	reply(w, http.StatusOK, rel)
+}
+
+func (s *Server) release(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/release/"))
+	if err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	rel, ok := s.Releases[id]
+	if !ok {
+		fail(w, http.StatusNotFound, "no such release")
+		return
+	}
+	reply(w, http.StatusOK, rel)
+}
+
+func (s *Server) releaseDelete(w http.ResponseWriter, r *http.Request) {
+	var body struct{ Id int }
+	if !readJSON(w, r.Body, &body) {
+		return
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	if _, ok := s.Releases[body.Id]; !ok {
+		fail(w, http.StatusNotFound, "no such release")
+		return
+	}
+	delete(s.Releases, body.Id)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) releasePublish(w http.ResponseWriter, r *http.Request) {
+	var body struct{ Id int }
+	if !readJSON(w, r.Body, &body) {
+		return
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	rel, ok := s.Releases[body.Id]
+	if !ok {
+		fail(w, http.StatusNotFound, "no such release")
+		return
+	}
+	rel.Draft = false
+	rel.PublishAt = nil
+	reply(w, http.StatusOK, rel)
+}
+
+func (s *Server) releases(w http.ResponseWriter, r *http.Request) {
+	series, _ := strconv.Atoi(r.FormValue("series"))
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	rs := make([]*dn.Release, 0)
+	for _, rel := range s.Releases {
+		if rel.SeriesId == series {
+			rs = append(rs, rel)
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Id < rs[j].Id })
+	reply(w, http.StatusOK, rs)
+}
+
+func (s *Server) series(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/series/"))
+	if err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	series, ok := s.Series[id]
+	if !ok {
+		fail(w, http.StatusNotFound, "no such series")
+		return
+	}
+	reply(w, http.StatusOK, series)
+}
+
+func (s *Server) latestNews(w http.ResponseWriter, r *http.Request) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	var latest *dn.NewsPost
+	for _, n := range s.News {
+		if latest == nil || n.Id > latest.Id {
+			latest = n
+		}
+	}
+	if latest == nil {
+		fail(w, http.StatusNotFound, "no news")
+		return
+	}
+	reply(w, http.StatusOK, latest)
+}
+
+func (s *Server) newsCreate(w http.ResponseWriter, r *http.Request) {
+	n := new(dn.NewsPost)
+	if !readJSON(w, r.Body, n) {
+		return
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	n.Id = s.id()
+	s.News[n.Id] = n
+	reply(w, http.StatusCreated, n)
+}
+
+func (s *Server) newsUpdate(w http.ResponseWriter, r *http.Request) {
+	n := new(dn.NewsPost)
+	if !readJSON(w, r.Body, n) {
+		return
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	if _, ok := s.News[n.Id]; !ok {
+		fail(w, http.StatusNotFound, "no such post")
+		return
+	}
+	s.News[n.Id] = n
+	reply(w, http.StatusOK, n)
+}
+
+func (s *Server) newsDelete(w http.ResponseWriter, r *http.Request) {
+	var body struct{ Id int }
+	if !readJSON(w, r.Body, &body) {
+		return
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	if _, ok := s.News[body.Id]; !ok {
+		fail(w, http.StatusNotFound, "no such post")
+		return
+	}
+	delete(s.News, body.Id)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) newsList(w http.ResponseWriter, r *http.Request) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	ns := make([]*dn.NewsPost, 0, len(s.News))
+	for _, n := range s.News {
+		ns = append(ns, n)
+	}
+	sort.Slice(ns, func(i, j int) bool { return ns[i].Id > ns[j].Id })
+	reply(w, http.StatusOK, ns)
+}
+
+func (s *Server) newsPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/news/"))
+	if err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	n, ok := s.News[id]
+	if !ok {
+		fail(w, http.StatusNotFound, "no such post")
+		return
+	}
+	reply(w, http.StatusOK, n)
+}
+
+func readJSON(w http.ResponseWriter, r io.Reader, v interface{}) bool {
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func reply(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func fail(w http.ResponseWriter, code int, msg string) {
+	reply(w, code, struct{ Msg, Err string }{http.StatusText(code), msg})
+}
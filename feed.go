@@ -0,0 +1,202 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/dn"
+	"ktkr.us/pkg/manga/feed"
+)
+
+var cmdFeed = &Command{
+	Name:    "feed",
+	Summary: "[-o <dir>] [-up] [-n <count>]",
+	Help: `
+Write Atom and JSON Feed documents, feed.atom and feed.json, of the releases
+and news posts published for the series. Releases come from the manifests
+that manga up keeps, without drafts and releases scheduled for later, and
+news posts from the copies that manga news keeps. Each release links to its
+archive on the download server, and each news post to its page on the site.
+
+The feeds are written to the top level of the series, or to the folder given
+with -o. With -up, they are uploaded to the download server as well.`,
+	Flags: flag.NewFlagSet("feed", flag.ExitOnError),
+}
+
+var (
+	feedO  = cmdFeed.Flags.String("o", "", "Write the feeds to `\033[4mDIR\033[m`")
+	feedUp = cmdFeed.Flags.Bool("up", false, "Upload the feeds to the download server")
+	feedN  = cmdFeed.Flags.Int("n", 50, "Include at most `\033[4mCOUNT\033[m` entries")
+)
+
+const (
+	atomFeedName = "feed.atom"
+	jsonFeedName = "feed.json"
+)
+
+func init() {
+	cmdFeed.Run = runFeed
+}
+
+func runFeed(cmd *Command, args []string) {
+	core.LoadConfig()
+
+	f, err := makeFeed()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	// each document links to itself
+	if *feedUp && core.Config.DLServ != "" {
+		f.FeedURL = core.DownloadURL(atomFeedName)
+	}
+	atom, err := f.Atom()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+	if f.FeedURL != "" {
+		f.FeedURL = core.DownloadURL(jsonFeedName)
+	}
+	jsonFeed, err := f.JSON()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	dir := *feedO
+	if dir == "" {
+		dir = core.TopLevel()
+	}
+	docs := []struct {
+		name string
+		data []byte
+	}{{atomFeedName, atom}, {jsonFeedName, jsonFeed}}
+
+	if *globalDryRun {
+		plan("%d entries", len(f.Entries))
+		for _, doc := range docs {
+			plan("write %s", filepath.Join(dir, doc.name))
+			if *feedUp {
+				plan("POST http://%s/upload  %s", core.Config.DLServ, doc.name)
+			}
+		}
+		return
+	}
+
+	for _, doc := range docs {
+		path := filepath.Join(dir, doc.name)
+		if err = ioutil.WriteFile(path, doc.data, 0644); err != nil {
+			cmd.Fatal(err)
+		}
+		cmd.Printf("wrote %s (%d entries)", path, len(f.Entries))
+	}
+
+	if !*feedUp {
+		return
+	}
+	client, err := dn.Default()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+	for _, doc := range docs {
+		if _, err = client.Upload(filepath.Join(dir, doc.name), nil); err != nil {
+			cmd.Fatalf("uploading %s: %v", doc.name, err)
+		}
+		cmd.Printf("uploaded %s", core.DownloadURL(doc.name))
+	}
+}
+
+// siteURL returns the address of the displaynone site.
+func siteURL() string {
+	if strings.Contains(core.Config.Remote, "://") {
+		return core.Config.Remote
+	}
+	return "http://" + core.Config.Remote
+}
+
+// newsURL returns the address of the news post with the given id.
+func newsURL(id int) string {
+	return siteURL() + "/news/" + strconv.Itoa(id)
+}
+
+// makeFeed collects the published releases and news posts of the series.
+func makeFeed() (*feed.Feed, error) {
+	site := siteURL()
+	f := &feed.Feed{
+		Title:  core.Config.Title,
+		Link:   site,
+		ID:     site + "/series/" + strconv.Itoa(core.Config.Id),
+		Author: core.Config.Group,
+	}
+	ids, err := core.Identifiers()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		m, err := core.LoadManifest(id)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", id, err)
+		}
+		if m.Id == 0 || m.Pending() {
+			continue
+		}
+
+		published := m.Uploaded
+		if !m.PublishAt.IsZero() {
+			published = m.PublishAt
+		}
+		e := &feed.Entry{
+			ID:        site + "/release/" + strconv.Itoa(m.Id),
+			Title:     fmt.Sprintf("%s %v", core.Config.Title, id),
+			Content:   m.Notes,
+			Published: published,
+		}
+		if m.Filename != "" && core.Config.DLServ != "" {
+			e.Link = core.DownloadURL(m.Filename)
+			e.Enclosure = &feed.Enclosure{URL: e.Link, Type: "application/zip", Length: m.Filesize}
+		}
+		f.Entries = append(f.Entries, e)
+	}
+
+	news, err := core.NewsRecords()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, n := range news {
+		if n.Posted.After(now) {
+			// scheduled
+			continue
+		}
+		f.Entries = append(f.Entries, &feed.Entry{
+			ID:        newsURL(n.Id),
+			Title:     n.Title,
+			Link:      newsURL(n.Id),
+			Content:   n.Body,
+			Published: n.Posted,
+			Updated:   n.Updated,
+		})
+	}
+
+	sort.Slice(f.Entries, func(i, j int) bool {
+		return f.Entries[i].Published.After(f.Entries[j].Published)
+	})
+	if *feedN > 0 && len(f.Entries) > *feedN {
+		f.Entries = f.Entries[:*feedN]
+	}
+	if len(f.Entries) > 0 {
+		f.Updated = f.Entries[0].Published
+		for _, e := range f.Entries {
+			if e.Updated.After(f.Updated) {
+				f.Updated = e.Updated
+			}
+		}
+	}
+	return f, nil
+}
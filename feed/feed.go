@@ -0,0 +1,185 @@
+// Package feed writes Atom and JSON Feed documents.
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"time"
+)
+
+// Feed is a feed of releases and news.
+type Feed struct {
+	Title   string
+	Link    string // the site
+	FeedURL string // where the feed itself is served, if known
+	ID      string
+	Author  string
+	Updated time.Time
+	Entries []*Entry
+}
+
+// Entry is one item of a feed.
+type Entry struct {
+	ID        string
+	Title     string
+	Link      string // the page readers open for the entry
+	Content   string // plain text
+	Published time.Time
+	Updated   time.Time // zero if never updated
+
+	Enclosure *Enclosure // attached file, if any
+}
+
+// Enclosure is a file attached to an entry.
+type Enclosure struct {
+	URL    string
+	Type   string
+	Length int64
+}
+
+func (e *Entry) updated() time.Time {
+	if e.Updated.IsZero() {
+		return e.Published
+	}
+	return e.Updated
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  *atomPerson `xml:"author,omitempty"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published"`
+	Links     []atomLink  `xml:"link"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Atom encodes the feed as an Atom document.
+func (f *Feed) Atom() ([]byte, error) {
+	a := &atomFeed{
+		Title:   f.Title,
+		ID:      f.ID,
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Links:   []atomLink{{Href: f.Link}},
+	}
+	if f.Author != "" {
+		a.Author = &atomPerson{Name: f.Author}
+	}
+	if f.FeedURL != "" {
+		a.Links = append(a.Links, atomLink{Href: f.FeedURL, Rel: "self", Type: "application/atom+xml"})
+	}
+
+	for _, e := range f.Entries {
+		ae := atomEntry{
+			Title:     e.Title,
+			ID:        e.ID,
+			Updated:   e.updated().UTC().Format(time.RFC3339),
+			Published: e.Published.UTC().Format(time.RFC3339),
+			Content:   atomContent{Type: "text", Body: e.Content},
+		}
+		if e.Link != "" {
+			ae.Links = append(ae.Links, atomLink{Href: e.Link, Rel: "alternate"})
+		}
+		if enc := e.Enclosure; enc != nil {
+			ae.Links = append(ae.Links, atomLink{Href: enc.URL, Rel: "enclosure", Type: enc.Type, Length: enc.Length})
+		}
+		a.Entries = append(a.Entries, ae)
+	}
+
+	buf, err := xml.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(buf, '\n')...), nil
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url,omitempty"`
+	Authors     []jsonAuthor   `json:"authors,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title"`
+	ContentText   string           `json:"content_text"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Attachments   []jsonAttachment `json:"attachments,omitempty"`
+}
+
+type jsonAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	SizeInBytes int64  `json:"size_in_bytes,omitempty"`
+}
+
+// JSON encodes the feed as a JSON Feed 1.1 document.
+func (f *Feed) JSON() ([]byte, error) {
+	j := &jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.Link,
+		FeedURL:     f.FeedURL,
+		Items:       []jsonFeedItem{},
+	}
+	if f.Author != "" {
+		j.Authors = []jsonAuthor{{Name: f.Author}}
+	}
+
+	for _, e := range f.Entries {
+		item := jsonFeedItem{
+			ID:            e.ID,
+			URL:           e.Link,
+			Title:         e.Title,
+			ContentText:   e.Content,
+			DatePublished: e.Published.UTC().Format(time.RFC3339),
+		}
+		if !e.Updated.IsZero() {
+			item.DateModified = e.Updated.UTC().Format(time.RFC3339)
+		}
+		if enc := e.Enclosure; enc != nil {
+			item.Attachments = []jsonAttachment{{URL: enc.URL, MimeType: enc.Type, SizeInBytes: enc.Length}}
+		}
+		j.Items = append(j.Items, item)
+	}
+
+	buf, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, '\n'), nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"text/template"
+
+	"ktkr.us/pkg/dn2/manga"
+
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/util"
+)
+
+// FormData is what the templates of a form destination can refer to.
+type FormData struct {
+	Config   interface{} // the series config from .manga
+	Id       core.Identifier
+	Chap     *core.ChapSplit // the chapter, or the whole release
+	Filename string
+	Size     util.Bytes
+	Match    []string // submatches of OK in the last response, for ReleaseURL
+}
+
+// formUploader uploads to a site described by a core.FormDest.
+type formUploader struct {
+	name    string
+	dest    *core.FormDest
+	u       *url.URL
+	ok, bad *regexp.Regexp
+	uploads []*formUpload
+	match   []string
+}
+
+// formUpload is one archive to send and its rendered form fields and headers.
+type formUpload struct {
+	path   string
+	data   *FormData
+	fields map[string]string
+	header map[string]string
+}
+
+func newFormUploader(name string, dest *core.FormDest) *formUploader {
+	return &formUploader{name: name, dest: dest}
+}
+
+func (f *formUploader) Name() string { return f.name }
+
+func (f *formUploader) Prepare(id core.Identifier) (err error) {
+	if f.u, err = url.Parse(f.dest.URL); err != nil {
+		return err
+	}
+	if f.u.Scheme != "http" && f.u.Scheme != "https" {
+		return fmt.Errorf("only http and https URLs are supported, not %q", f.dest.URL)
+	}
+	if f.dest.OK != "" {
+		if f.ok, err = regexp.Compile(f.dest.OK); err != nil {
+			return fmt.Errorf("OK: %v", err)
+		}
+	}
+	if f.dest.Error != "" {
+		if f.bad, err = regexp.Compile(f.dest.Error); err != nil {
+			return fmt.Errorf("Error: %v", err)
+		}
+	}
+	if _, err = template.New("ReleaseURL").Parse(f.dest.ReleaseURL); err != nil {
+		return err
+	}
+
+	if f.uploads, err = formUploads(id, f.dest.PerChapter); err != nil {
+		return err
+	}
+	for _, up := range f.uploads {
+		if up.fields, err = renderFields(f.dest.Fields, up.data); err != nil {
+			return err
+		}
+		if up.header, err = renderFields(f.dest.Header, up.data); err != nil {
+			return err
+		}
+	}
+
+	if *globalDryRun {
+		for _, up := range f.uploads {
+			plan("POST %s  %s=%q (%v)", f.u, f.fileField(), up.data.Filename, up.data.Size)
+			for k, v := range up.fields {
+				plan("    %s: %s", k, v)
+			}
+		}
+	}
+	return nil
+}
+
+// formUploads lists the archives to upload for id, one per chapter of a
+// volume if perChapter is set.
+func formUploads(id core.Identifier, perChapter bool) ([]*formUpload, error) {
+	var (
+		chaps []*core.ChapSplit
+		paths []string
+	)
+	if perChapter && id.Kind == manga.Volume {
+		chaps = core.ParseSplits(id)
+		for _, chap := range chaps {
+			paths = append(paths, util.Rooted(chap.ZipName()))
+		}
+	} else {
+		fi, err := core.FirstArchive(id)
+		if err != nil {
+			return nil, err
+		}
+		chap := &core.ChapSplit{Id: id}
+		if id.Kind == manga.Chapter {
+			chap.Num = strconv.Itoa(id.Ordinal)
+		}
+		chaps = []*core.ChapSplit{chap}
+		paths = []string{util.Rooted(fi.Name())}
+	}
+
+	uploads := make([]*formUpload, len(chaps))
+	for i, chap := range chaps {
+		fi, err := os.Stat(paths[i])
+		if err != nil {
+			return nil, err
+		}
+		uploads[i] = &formUpload{
+			path: paths[i],
+			data: &FormData{
+				Config:   &core.Config,
+				Id:       id,
+				Chap:     chap,
+				Filename: fi.Name(),
+				Size:     util.Bytes(fi.Size()),
+			},
+		}
+	}
+	return uploads, nil
+}
+
+// renderFields executes each of the templates in fields with data.
+func renderFields(fields map[string]string, data *FormData) (map[string]string, error) {
+	out := make(map[string]string, len(fields))
+	for k, text := range fields {
+		s, err := executeString(k, text, data)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = s
+	}
+	return out, nil
+}
+
+func executeString(name, text string, data interface{}) (string, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err = t.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (f *formUploader) fileField() string {
+	if f.dest.FileField == "" {
+		return "file"
+	}
+	return f.dest.FileField
+}
+
+func (f *formUploader) Upload(p chan string) error {
+	for _, up := range f.uploads {
+		if len(f.uploads) > 1 {
+			p <- "Uploading " + up.data.Filename + "..."
+		}
+		if err := f.upload(up, p); err != nil {
+			return fmt.Errorf("%s: %v", up.data.Filename, err)
+		}
+	}
+	return nil
+}
+
+func (f *formUploader) upload(up *formUpload, p chan string) error {
+	formReader, formWriter := io.Pipe()
+	form := multipart.NewWriter(formWriter)
+
+	go func() {
+		formWriter.CloseWithError(writeUploadForm(form, f.fileField(), up))
+	}()
+
+	totalSize := util.FormSize(form, up.fields, f.fileField(), filepath.Base(up.path), up.data.Size)
+	resp, err := util.UploadFileProgress(httpClient, f.u.String(), formReader, form, totalSize, up.header, p)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response: %v", err)
+	}
+
+	want := f.dest.Status
+	if want == 0 && resp.StatusCode/100 == 2 {
+		want = resp.StatusCode
+	}
+	if resp.StatusCode != want {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	if f.bad != nil {
+		if m := f.bad.FindSubmatch(body); m != nil {
+			if len(m) > 1 {
+				return fmt.Errorf("server returned error: %s", m[1])
+			}
+			return fmt.Errorf("server returned error: %s", m[0])
+		}
+	}
+	if f.ok != nil {
+		m := f.ok.FindSubmatch(body)
+		if m == nil {
+			return fmt.Errorf("unexpected response: %.200s", bytes.TrimSpace(body))
+		}
+		f.match = make([]string, len(m))
+		for i := range m {
+			f.match[i] = string(m[i])
+		}
+	}
+	return nil
+}
+
+func writeUploadForm(form *multipart.Writer, field string, up *formUpload) error {
+	for k, v := range up.fields {
+		if err := form.WriteField(k, v); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(up.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w, err := form.CreateFormFile(field, filepath.Base(up.path))
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, file); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// Post has nothing to do, as the form upload is all there is.
+func (f *formUploader) Post() error { return nil }
+
+func (f *formUploader) URL() string {
+	if f.dest.ReleaseURL == "" || len(f.uploads) == 0 {
+		return ""
+	}
+	data := *f.uploads[len(f.uploads)-1].data
+	data.Match = f.match
+	s, err := executeString("ReleaseURL", f.dest.ReleaseURL, &data)
+	if err != nil {
+		return ""
+	}
+	return s
+}
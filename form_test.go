@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/util"
+)
+
+func TestFormUpload(t *testing.T) {
+	archive := bytes.Repeat([]byte("zip data "), 20000)
+	path := filepath.Join(t.TempDir(), "Title v01 [G].zip")
+	if err := ioutil.WriteFile(path, archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		body   []byte
+		header http.Header
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		w.Write([]byte("OK:abc123\n"))
+	}))
+	defer s.Close()
+
+	f := newFormUploader("site", &core.FormDest{
+		URL:        s.URL + "/upload",
+		FileField:  "archive",
+		OK:         "^OK:(.*)",
+		Error:      "^ERROR:(.*)",
+		ReleaseURL: s.URL + "/r/{{index .Match 1}}",
+	})
+	f.ok = regexp.MustCompile(f.dest.OK)
+	f.bad = regexp.MustCompile(f.dest.Error)
+	var err error
+	if f.u, err = url.Parse(f.dest.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	// a field much larger than the archive, to show in the progress total
+	up := &formUpload{
+		path:   path,
+		data:   &FormData{Filename: filepath.Base(path), Size: util.Bytes(len(archive))},
+		fields: map[string]string{"series": "Title", "notes": strings.Repeat("long notes ", 50000)},
+		header: map[string]string{"X-Key": "secret"},
+	}
+	f.uploads = []*formUpload{up}
+
+	p := make(chan string)
+	go func() {
+		for range p {
+		}
+	}()
+	if err = f.upload(up, p); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.URL(); got != s.URL+"/r/abc123" {
+		t.Errorf("URL() = %q", got)
+	}
+	if header.Get("X-Key") != "secret" {
+		t.Errorf("header %v", header)
+	}
+
+	_, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Value["series"][0] != "Title" || form.Value["notes"][0] != up.fields["notes"] {
+		t.Errorf("form values %.100v", form.Value)
+	}
+	if fh := form.File["archive"]; len(fh) != 1 || fh[0].Filename != "Title v01 [G].zip" || fh[0].Size != int64(len(archive)) {
+		t.Errorf("form files %v", form.File)
+	}
+
+	// the progress total is the whole body, not just the archive
+	mw := multipart.NewWriter(nil)
+	mw.SetBoundary(params["boundary"])
+	if size := util.FormSize(mw, up.fields, "archive", "Title v01 [G].zip", up.data.Size); int(size) != len(body) {
+		t.Errorf("FormSize = %d, body was %d bytes", size, len(body))
+	}
+}
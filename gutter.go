@@ -0,0 +1,134 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"math"
+	"sort"
+)
+
+const (
+	// gutterSearch is how far from the middle of a scan, as a fraction of its
+	// width after rotating, the gutter is looked for.
+	gutterSearch = 0.1
+
+	// The band found has to stand out from both sides of it by this many
+	// times the median deviation in the search area, and by this many gray
+	// levels, to be trusted as the gutter.
+	gutterMinScore = 6
+	gutterMinDelta = 8
+)
+
+// findGutter looks for the spine in the scan m: the darkest or lightest band
+// near the middle of the scan as prep rotates it, where the original rows are
+// the columns. It returns where the band is, in percent of the rotated width,
+// and whether it stands out enough to be trusted.
+func findGutter(m image.Image) (percent float64, ok bool) {
+	means, spreads := rowLevels(m)
+	rows, spreads := smoothLevels(means), smoothLevels(spreads)
+	n := len(rows)
+	side := n / 60 // how far to either side of the band to compare it with
+	lo := int(float64(n) * (0.5 - gutterSearch))
+	hi := int(float64(n) * (0.5 + gutterSearch))
+	if side < 1 || lo-side < 0 || hi+side > n || hi-lo < 3 {
+		return 50, false
+	}
+
+	// the spine is darker or lighter than both sides of it, and evenly so
+	// along its length, unlike a line of text
+	contrast := make([]float64, hi-lo)
+	best := 0
+	for i := range contrast {
+		y := lo + i
+		dl, dr := rows[y]-rows[y-side], rows[y]-rows[y+side]
+		if c := math.Min(math.Abs(dl), math.Abs(dr)); dl*dr > 0 && spreads[y] < c {
+			contrast[i] = c
+		}
+		if contrast[i] > contrast[best] {
+			best = i
+		}
+	}
+
+	med := median(rows[lo:hi])
+	devs := make([]float64, hi-lo)
+	for i, v := range rows[lo:hi] {
+		devs[i] = math.Abs(v - med)
+	}
+	mad := median(devs)
+
+	c := contrast[best]
+	if c < gutterMinDelta || c < gutterMinScore*mad {
+		return 50, false
+	}
+
+	// take the middle of the band
+	first, last := best, best
+	for first > 0 && contrast[first-1] >= c*0.9 {
+		first--
+	}
+	for last < len(contrast)-1 && contrast[last+1] >= c*0.9 {
+		last++
+	}
+	return float64(lo+(first+last)/2) / float64(n) * 100, true
+}
+
+// smoothLevels averages out scanner noise and text in levels.
+func smoothLevels(levels []float64) []float64 {
+	r := len(levels) / 400
+	if r < 1 {
+		r = 1
+	}
+	smooth := make([]float64, len(levels))
+	for i := range smooth {
+		var sum float64
+		count := 0
+		for k := i - r; k <= i+r; k++ {
+			if k >= 0 && k < len(levels) {
+				sum += levels[k]
+				count++
+			}
+		}
+		smooth[i] = sum / float64(count)
+	}
+	return smooth
+}
+
+// rowLevels returns the mean gray level of each row of m, and how much the
+// levels along the row deviate from it, sampling a few hundred pixels across.
+func rowLevels(m image.Image) (means, spreads []float64) {
+	b := m.Bounds()
+	step := b.Dx() / 400
+	if step < 1 {
+		step = 1
+	}
+
+	means = make([]float64, b.Dy())
+	spreads = make([]float64, b.Dy())
+	ycc, isYCbCr := m.(*image.YCbCr)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		var sum, sumSq float64
+		count := 0
+		for x := b.Min.X; x < b.Max.X; x += step {
+			var v float64
+			if isYCbCr {
+				v = float64(ycc.Y[ycc.YOffset(x, y)])
+			} else {
+				v = float64(color.GrayModel.Convert(m.At(x, y)).(color.Gray).Y)
+			}
+			sum += v
+			sumSq += v * v
+			count++
+		}
+		mean := sum / float64(count)
+		means[y-b.Min.Y] = mean
+		spreads[y-b.Min.Y] = math.Sqrt(math.Max(0, sumSq/float64(count)-mean*mean))
+	}
+	return means, spreads
+}
+
+func median(vs []float64) float64 {
+	sorted := append([]float64(nil), vs...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
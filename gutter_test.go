@@ -0,0 +1,101 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// testScan makes a scan as prep sees it before rotating, w×h with the rows
+// across the spine: paper of the given level with scanner noise and lines of
+// text, and a band of level band (none if 0) centered on row gutter, which
+// should be between lines of text.
+func testScan(w, h int, paper, band uint8, gutter int) *image.Gray {
+	rng := rand.New(rand.NewSource(int64(w*h + gutter)))
+	m := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		// text fills a few rows out of every twenty, leaving margins
+		text := y%20 < 6 && y > h/20 && y < h-h/20
+		for x := 0; x < w; x++ {
+			v := int(paper) + rng.Intn(9) - 4
+			if text && x > w/10 && x < w-w/10 && rng.Intn(3) == 0 {
+				v = 30
+			}
+			m.SetGray(x, y, color.Gray{uint8(v)})
+		}
+	}
+	if band != 0 {
+		for y := gutter - h/200; y <= gutter+h/200; y++ {
+			for x := 0; x < w; x++ {
+				m.SetGray(x, y, color.Gray{band + uint8(rng.Intn(5))})
+			}
+		}
+	}
+	return m
+}
+
+// toYCbCr converts m to the YCbCr image a JPEG decodes to.
+func toYCbCr(m *image.Gray) *image.YCbCr {
+	b := m.Bounds()
+	ycc := image.NewYCbCr(b, image.YCbCrSubsampleRatio420)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			ycc.Y[ycc.YOffset(x, y)] = m.GrayAt(x, y).Y
+		}
+	}
+	for i := range ycc.Cb {
+		ycc.Cb[i], ycc.Cr[i] = 128, 128
+	}
+	return ycc
+}
+
+func TestFindGutter(t *testing.T) {
+	tests := []struct {
+		name   string
+		m      image.Image
+		want   float64 // percent, if found
+		ok     bool
+		margin float64
+	}{
+		{"dark spine", testScan(500, 1000, 235, 140, 472), 47.2, true, 0.5},
+		{"light spine", testScan(500, 1000, 120, 200, 532), 53.2, true, 0.5},
+		{"off center", testScan(400, 1200, 230, 120, 672), 56, true, 0.5},
+		{"jpeg", toYCbCr(testScan(500, 1000, 235, 140, 452)), 45.2, true, 0.5},
+		{"faint", testScan(500, 1000, 235, 231, 512), 50, false, 0},
+		{"none", testScan(500, 1000, 235, 0, 0), 50, false, 0},
+		// too far from the middle to be the spine
+		{"outside", testScan(500, 1000, 235, 140, 312), 50, false, 0},
+		{"tiny", testScan(20, 30, 235, 140, 15), 50, false, 0},
+	}
+	for _, tt := range tests {
+		got, ok := findGutter(tt.m)
+		if ok != tt.ok || math.Abs(got-tt.want) > tt.margin {
+			t.Errorf("%s: findGutter = %.2f, %v; want %.2f, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		vs   []float64
+		want float64
+	}{
+		{[]float64{3}, 3},
+		{[]float64{5, 1, 3}, 3},
+		{[]float64{4, 1, 3, 2}, 3},
+	}
+	for _, tt := range tests {
+		vs := append([]float64(nil), tt.vs...)
+		if got := median(vs); got != tt.want {
+			t.Errorf("median(%v) = %v, want %v", tt.vs, got, tt.want)
+		}
+		for i := range vs {
+			if vs[i] != tt.vs[i] {
+				t.Errorf("median(%v) reordered its argument", tt.vs)
+				break
+			}
+		}
+	}
+}
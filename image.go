@@ -32,6 +32,9 @@ type Image struct {
 
 	// invalid until call to size()
 	Rect
+
+	// shaped like a spread; set by detectSpreads
+	Wide bool
 }
 
 func namedImage(name string) *Image {
@@ -184,9 +187,25 @@ func (im *Image) convert(args ...string) {
 	//args = append([]string{"convert", im.Path}, args...)
 	//util.System("gm", args...)
 	args = append([]string{im.Path}, args...)
+	if *globalDryRun {
+		plan("convert %s", quoteArgs(args))
+		return
+	}
 	util.System("convert", args...)
 }
 
+// quoteArgs formats a command line argument list for printing.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t'\"%^") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
 func (im *Image) ord() int {
 	s := strings.Split(im.name(), "-")
 	n, _ := strconv.Atoi(s[0])
@@ -221,6 +240,10 @@ func (im *Image) open() *os.File {
 }
 
 func (im *Image) optimize() {
+	if *globalDryRun {
+		plan("optimize %s", im.Path)
+		return
+	}
 	switch im.ext() {
 	case ".jpg":
 		util.System("jpegoptim", "--strip-all", im.Path)
@@ -231,8 +254,16 @@ func (im *Image) optimize() {
 	}
 }
 
-// performs f on each image in parallel with GOMAXPROCS workers
+// performs f on each image in parallel with GOMAXPROCS workers, or serially
+// for dry runs so that the planned actions print in order
 func imgdo(banner string, ims []*Image, f func(*Image)) {
+	if *globalDryRun {
+		for _, im := range ims {
+			f(im)
+		}
+		return
+	}
+
 	switch len(ims) {
 	case 1:
 		f(ims[0])
@@ -2,14 +2,19 @@ package main
 
 import (
 	"flag"
+	"os"
 	"path/filepath"
+
+	"ktkr.us/pkg/manga/core"
 )
 
 var cmdInit = &Command{
 	Name:    "init",
 	Summary: "[-n] <identifier>",
 	Help: `
-Initializes a new work directory in the current series.`,
+Initializes a new work directory in the current series. One folder is created
+for each stage listed in the Stages section of .manga, or raw, pages, psd, res
+and out if there is none.`,
 	Flags: flag.NewFlagSet("init", flag.ExitOnError),
 }
 
@@ -28,7 +33,16 @@ func runInit(cmd *Command, args []string) {
 
 	cmd.identifier(args[0])
 
-	for _, d := range []string{"raw", "res", "psd"} {
-		cmd.mkdir(filepath.Join(args[0], d))
+	if core.InProject() {
+		wd, err := os.Getwd()
+		if err != nil {
+			cmd.Fatal(err)
+		}
+		core.LoadSeries()
+		os.Chdir(wd)
+	}
+
+	for _, s := range core.Stages() {
+		cmd.mkdir(filepath.Join(args[0], core.StageDir(s.Name)))
 	}
 }
@@ -38,6 +38,23 @@ type Group []*Running
 // them returns an error, the whole group will be canelled and that error will
 // be returned.
 func (g Group) Begin() error {
+	for _, err := range g.run(true) {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Wait runs a job group like Begin, but lets every job finish even if others
+// fail. It returns the jobs' errors in the order of the group.
+func (g Group) Wait() []error {
+	return g.run(false)
+}
+
+func (g Group) run(stopOnError bool) []error {
+	errs := make([]error, len(g))
+
 	// Figure out how to visually align the printout.
 	nameSize := 0
 	for _, j := range g {
@@ -76,22 +93,24 @@ func (g Group) Begin() error {
 	// Fan-in job progress and update lines in print-out accordingly. We only
 	// want one goroutine printing stuff out.
 	a := len(g)
-	for {
+	for a > 0 {
 		select {
 		case p := <-prg:
 			g.updateLine(p, format)
 		case j := <-done:
+			errs[j.id] = j.err
+			a--
 			if j.err != nil {
-				g.updateLine(progress{j, "Error"}, format)
-				return j.err
+				g.updateLine(progress{j, "Error: " + j.err.Error()}, format)
+				if stopOnError {
+					return errs
+				}
+				continue
 			}
 			g.updateLine(progress{j, "Done"}, format)
-			a--
-			if a <= 0 {
-				return nil
-			}
 		}
 	}
+	return errs
 }
 
 func (g Group) updateLine(p progress, format string) {
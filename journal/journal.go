@@ -0,0 +1,228 @@
+// Package journal records the file operations done by a command so that they
+// can be rolled back later. Every entry is synced to disk before the operation
+// it describes is carried out, so a journal left behind by a crash can still
+// be undone.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"ktkr.us/pkg/manga/util"
+)
+
+// Dir is the name of the folder journals are kept in.
+const Dir = ".journal"
+
+const logName = "log"
+
+// ErrEmpty is returned by Undo when there is nothing left to undo.
+var ErrEmpty = errors.New("nothing to undo")
+
+type opKind string
+
+const (
+	opRename opKind = "rename"
+	opCreate opKind = "create"
+	opWrite  opKind = "write"
+)
+
+type entry struct {
+	Op    opKind
+	Path  string
+	From  string `json:",omitempty"` // original path of a renamed file
+	Stash string `json:",omitempty"` // stashed copy of an overwritten file
+}
+
+// Journal is an append-only record of the file operations of one command run.
+// It is safe for concurrent use. A nil Journal records nothing.
+type Journal struct {
+	dir  string
+	file *os.File
+	enc  *json.Encoder
+	seen map[string]bool
+	n    int
+	mu   sync.Mutex
+}
+
+// Begin starts a new journal for the command called name inside the folder
+// dir.
+func Begin(dir, name string) (*Journal, error) {
+	jdir := filepath.Join(dir, Dir, time.Now().Format("20060102-150405.000")+"-"+name)
+	if err := os.MkdirAll(jdir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(jdir, logName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{
+		dir:  jdir,
+		file: file,
+		enc:  json.NewEncoder(file),
+		seen: make(map[string]bool),
+	}, nil
+}
+
+func (j *Journal) record(e entry) error {
+	if err := j.enc.Encode(e); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// Rename records and then performs the renaming of oldpath to newpath. If
+// newpath already exists, it is stashed first.
+func (j *Journal) Rename(oldpath, newpath string) error {
+	if j == nil {
+		return os.Rename(oldpath, newpath)
+	}
+	if err := j.Write(newpath); err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.record(entry{Op: opRename, Path: newpath, From: oldpath}); err != nil {
+		return err
+	}
+	return os.Rename(oldpath, newpath)
+}
+
+// Write records that the file at path is about to be created or overwritten.
+// An existing file is stashed in the journal so it can be restored. Only the
+// first call for any path has an effect.
+func (j *Journal) Write(path string) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.seen[path] {
+		return nil
+	}
+	j.seen[path] = true
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return j.record(entry{Op: opCreate, Path: path})
+	} else if err != nil {
+		return err
+	}
+
+	j.n++
+	stash := filepath.Join(j.dir, strconv.Itoa(j.n)+filepath.Ext(path))
+	if err := util.CopyFile(stash, path); err != nil {
+		return err
+	}
+	return j.record(entry{Op: opWrite, Path: path, Stash: stash})
+}
+
+// Close closes the journal. The journal stays on disk until it is undone.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	return j.file.Close()
+}
+
+// Undo reverts the most recent journal in dir and removes it, returning the
+// name of the command that was undone.
+func Undo(dir string) (string, error) {
+	jdir, name, err := last(dir)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := readLog(filepath.Join(jdir, logName))
+	if err != nil {
+		return "", err
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err = undo(entries[i]); err != nil {
+			return "", fmt.Errorf("undo %s: %v", name, err)
+		}
+	}
+
+	return name, os.RemoveAll(jdir)
+}
+
+// undo reverts a single entry. Entries whose operation never happened because
+// the command was interrupted are skipped.
+func undo(e entry) error {
+	switch e.Op {
+	case opRename:
+		if _, err := os.Stat(e.Path); os.IsNotExist(err) {
+			return nil
+		}
+		return os.Rename(e.Path, e.From)
+	case opCreate:
+		if err := os.Remove(e.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	case opWrite:
+		return util.CopyFile(e.Path, e.Stash)
+	}
+	return fmt.Errorf("unknown journal operation '%s'", e.Op)
+}
+
+// last finds the newest journal in dir.
+func last(dir string) (path, name string, err error) {
+	fis, err := ioutil.ReadDir(filepath.Join(dir, Dir))
+	if os.IsNotExist(err) {
+		return "", "", ErrEmpty
+	} else if err != nil {
+		return "", "", err
+	}
+
+	names := make([]string, 0, len(fis))
+	for _, fi := range fis {
+		if fi.IsDir() {
+			names = append(names, fi.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "", "", ErrEmpty
+	}
+
+	// names start with a sortable timestamp
+	sort.Strings(names)
+	path = filepath.Join(dir, Dir, names[len(names)-1])
+	name = names[len(names)-1]
+	if i := len("20060102-150405.000-"); len(name) > i {
+		name = name[i:]
+	}
+	return path, name, nil
+}
+
+func readLog(path string) ([]entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make([]entry, 0)
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		var e entry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			// the last line may be cut off if the command crashed while
+			// writing it, in which case its operation never started
+			break
+		}
+		entries = append(entries, e)
+	}
+	return entries, s.Err()
+}
@@ -7,14 +7,12 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
 
-	"ktkr.us/pkg/dn2/manga"
-
 	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/journal"
 	"ktkr.us/pkg/manga/util"
 )
 
@@ -22,6 +20,7 @@ var (
 	spreadPattern = regexp.MustCompile(`^\d+(\-|[a-zA-Z])(\d+|\w*)`)
 	pagePattern   = regexp.MustCompile(`^\d+`)
 	globalX       *bool
+	globalDryRun  = new(bool)
 )
 
 var commands = []*Command{
@@ -34,6 +33,12 @@ var commands = []*Command{
 	cmdNews,
 	cmdTest,
 	cmdConfig,
+	cmdUndo,
+	cmdRelease,
+	cmdStatus,
+	cmdCover,
+	cmdTorrent,
+	cmdFeed,
 }
 
 func main() {
@@ -63,6 +68,9 @@ func main() {
 			c.init()
 			if c.Flags != nil {
 				globalX = c.Flags.Bool("x", false, "Use provided file list instead")
+				globalDryRun = c.Flags.Bool("dry-run", false, "Print planned actions without doing them")
+				c.Flags.BoolVar(&util.AssumeYes, "yes", false, "Answer yes to all prompts")
+				c.Flags.BoolVar(&util.NoInput, "no-input", false, "Never prompt or open an editor; fail instead")
 				c.Flags.Parse(args)
 				c.Run(c, c.Flags.Args())
 			} else {
@@ -82,6 +90,10 @@ type Command struct {
 	Summary string
 	Help    string
 	Flags   *flag.FlagSet
+
+	// Stages the command reads from and writes to by default. The Pipeline
+	// section of .manga can override these per command.
+	Stages core.StageIO
 	*log.Logger
 }
 
@@ -96,42 +108,97 @@ func (cmd *Command) mkdir(name string) {
 	}
 }
 
-// TODO: how do we identify oneshots?
 func (cmd *Command) identifier(s string) core.Identifier {
-	if len(s) < 2 {
-		cmd.Fatalf("%s: invalid identifier", s)
+	id, err := core.ParseIdentifier(s)
+	if err != nil {
+		cmd.Fatal(err)
 	}
+	return id
+}
+
+// stages returns the stages cmd reads from and writes to in this series.
+func (cmd *Command) stages() core.StageIO {
+	return core.CommandStages(cmd.Name, cmd.Stages)
+}
 
-	n := strings.IndexFunc(s, func(ch rune) bool { return '0' <= ch && ch <= '9' })
-	if n == -1 {
-		cmd.Fatalf("%s: invalid identifier", s)
+// in changes into the folder of the named stage for identifier id.
+func (cmd *Command) in(id, stage string) {
+	cmd.identifier(id)
+	if err := os.Chdir(filepath.Join(id, core.StageDir(stage))); err != nil {
+		cmd.Fatal(err)
+	}
+}
+
+// inImages changes into the input folder of cmd for identifier id and returns
+// the images of the given kinds in it. If it is missing or has none, as in
+// series laid out before the folder was used, the closest stage before it that
+// has some is used instead.
+func (cmd *Command) inImages(id string, kinds ...ImageKind) []*Image {
+	cmd.identifier(id)
+	want := cmd.stages().In
+	for stage, ok := want, true; ok; stage, ok = core.StageBefore(stage) {
+		if os.Chdir(util.Rooted(id, core.StageDir(stage))) != nil {
+			continue
+		}
+		if ims := images(kinds...); len(ims) > 0 {
+			if stage != want {
+				cmd.Printf("no images in %s; using %s", core.StageDir(want), core.StageDir(stage))
+			}
+			return ims
+		}
 	}
+	cmd.in(id, want)
+	return images(kinds...)
+}
 
-	ord, err := strconv.Atoi(s[n:])
+// outDir returns the absolute path of the folder cmd writes its results to
+// when processing identifier id, creating it if necessary. It must be called
+// from within the input folder. If inPlace is set, or the command's input and
+// output stages share a folder, the input folder is returned. Without an
+// identifier (-x), the output folder is created inside the working directory.
+func (cmd *Command) outDir(id string, inPlace bool) string {
+	wd, err := os.Getwd()
 	if err != nil {
-		cmd.Fatalf("%s: invalid identifier: %v", s, err)
+		cmd.Fatal(err)
 	}
-	id := core.Identifier{Ordinal: ord}
-
-	switch pre := s[:n]; pre {
-	case "v":
-		id.Kind = manga.Volume
-	case "c":
-		id.Kind = manga.Chapter
-	case "cd":
-		id.Kind = manga.DramaCD
-	default:
-		cmd.Fatalf("%s: invalid kind specifier '%s' in identifier", s, pre)
+	if inPlace {
+		return wd
 	}
 
-	return id
+	out := core.StageDir(cmd.stages().Out)
+	var dir string
+	if id == "" {
+		dir = filepath.Join(wd, out)
+	} else {
+		dir = util.Rooted(id, out)
+	}
+
+	if dir != wd && !*globalDryRun {
+		cmd.mkdir(dir)
+	}
+	return dir
 }
 
-func (cmd *Command) in(id, path string) {
-	cmd.identifier(id)
-	if err := os.Chdir(filepath.Join(id, path)); err != nil {
+// plan prints an action that would have been taken if not for -dry-run.
+func plan(format string, args ...interface{}) {
+	fmt.Printf(format+"\n", args...)
+}
+
+// journal starts an undo journal for cmd in the folder of identifier id, or
+// in the working directory if id is empty. No journal is kept for dry runs.
+func (cmd *Command) journal(id string) *journal.Journal {
+	if *globalDryRun {
+		return nil
+	}
+	dir := "."
+	if id != "" {
+		dir = util.Rooted(id)
+	}
+	j, err := journal.Begin(dir, cmd.Name)
+	if err != nil {
 		cmd.Fatal(err)
 	}
+	return j
 }
 
 type Link struct {
@@ -183,12 +250,3 @@ func help(cmd *Command) {
 
 	os.Exit(1)
 }
-
-type Error struct {
-	Msg string
-	Err string
-}
-
-func (e Error) Error() string {
-	return e.Msg + ": " + e.Err
-}
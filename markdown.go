@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"ktkr.us/pkg/manga/util"
+)
+
+// maxPostLength is the most characters a news post or release notes may have.
+const maxPostLength = 20000
+
+var (
+	mdLink     = regexp.MustCompile(`\[([^\]]*)\]\(([^)]*)\)`)
+	mdOpenLink = regexp.MustCompile(`\[[^\]]*\]\([^)]*$`)
+	mdAutoLink = regexp.MustCompile(`<([a-z]+:[^>\s]*)>`)
+	mdCode     = regexp.MustCompile("`([^`]+)`")
+
+	// links after escaping, without titles
+	mdEscLink     = regexp.MustCompile(`\[([^\]]*)\]\(([^)\s]*)[^)]*\)`)
+	mdEscAutoLink = regexp.MustCompile(`&lt;([a-z]+:[^&\s]*)&gt;`)
+
+	mdStrong     = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	mdEm         = regexp.MustCompile(`\*([^*]+)\*`)
+	mdHeading    = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	mdListItem   = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	mdNumberItem = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+)
+
+// checkPost returns the problems with the markdown text of a news post or
+// release notes: an empty body, template placeholders left over, malformed
+// links and too much text.
+func checkPost(text string) []string {
+	var problems []string
+	if strings.TrimSpace(text) == "" {
+		return []string{"the body is empty"}
+	}
+	if n := utf8.RuneCountInString(text); n > maxPostLength {
+		problems = append(problems, fmt.Sprintf("the body is %d characters long (at most %d)", n, maxPostLength))
+	}
+
+	for i, line := range strings.Split(text, "\n") {
+		num := i + 1
+		if strings.Contains(line, "{{") || strings.Contains(line, "}}") {
+			problems = append(problems, fmt.Sprintf("line %d: template placeholder left over", num))
+		}
+		if strings.Contains(line, "<no value>") {
+			problems = append(problems, fmt.Sprintf("line %d: template value missing (<no value>)", num))
+		}
+		for _, m := range mdLink.FindAllStringSubmatch(line, -1) {
+			if err := checkLink(m[2]); err != nil {
+				problems = append(problems, fmt.Sprintf("line %d: link %q: %v", num, m[2], err))
+			}
+		}
+		for _, m := range mdAutoLink.FindAllStringSubmatch(line, -1) {
+			if err := checkLink(m[1]); err != nil {
+				problems = append(problems, fmt.Sprintf("line %d: link %q: %v", num, m[1], err))
+			}
+		}
+		if mdOpenLink.MatchString(mdLink.ReplaceAllString(line, "")) {
+			problems = append(problems, fmt.Sprintf("line %d: link isn't closed with )", num))
+		}
+	}
+	return problems
+}
+
+// checkLink checks the target of a link, which may be an absolute http(s) or
+// mailto URL, or a path on the site.
+func checkLink(target string) error {
+	// a link may have a title after the URL
+	if i := strings.IndexAny(target, " \t"); i >= 0 {
+		target = target[:i]
+	}
+	if target == "" {
+		return fmt.Errorf("no URL")
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return fmt.Errorf("no host")
+		}
+	case "mailto":
+		if u.Opaque == "" {
+			return fmt.Errorf("no address")
+		}
+	case "":
+		if !strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "#") {
+			return fmt.Errorf("relative URL (use a full http:// or https:// URL)")
+		}
+	default:
+		return fmt.Errorf("unsupported scheme %s", u.Scheme)
+	}
+	return nil
+}
+
+// postProblems prints the problems with text, returning an error if there are
+// any.
+func postProblems(cmd *Command, text string) error {
+	problems := checkPost(text)
+	for _, p := range problems {
+		cmd.Print(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problem%s found; nothing was posted", len(problems), util.Plural(len(problems)))
+	}
+	return nil
+}
+
+// validatePost exits listing the problems with text, if any.
+func validatePost(cmd *Command, text string) {
+	if err := postProblems(cmd, text); err != nil {
+		cmd.Fatal(err)
+	}
+}
+
+// reviewPost checks text, which was edited in $EDITOR, writes an HTML preview
+// of it and asks whether to post it. It returns an error if text has problems
+// or if the answer is no.
+func reviewPost(cmd *Command, title, text string) error {
+	if err := postProblems(cmd, text); err != nil {
+		return err
+	}
+
+	// the preview is only needed until the question is answered
+	file, err := ioutil.TempFile("", "manga-preview-*.html")
+	if err != nil {
+		return fmt.Errorf("writing preview: %v", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = io.WriteString(file, previewHTML(title, text))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("writing preview: %v", err)
+	}
+	cmd.Printf("preview written to %s", file.Name())
+	if !util.Promptf("Post %q?", title) {
+		return fmt.Errorf("not posted")
+	}
+	return nil
+}
+
+// previewHTML renders a page with the markdown text under a heading.
+func previewHTML(title, text string) string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "<!DOCTYPE html>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", html.EscapeString(title))
+	fmt.Fprintln(buf, `<style>body { max-width: 40em; margin: 2em auto; font-family: sans-serif; line-height: 1.5 }</style>`)
+	fmt.Fprintf(buf, "<h1>%s</h1>\n", html.EscapeString(title))
+	buf.WriteString(renderMarkdown(text))
+	return buf.String()
+}
+
+// renderMarkdown converts the common parts of markdown to HTML: headings,
+// paragraphs, lists, code blocks, quotes, links, code and emphasis. It is only
+// meant for previews; the site renders posts itself.
+func renderMarkdown(text string) string {
+	buf := new(bytes.Buffer)
+	var (
+		para   []string
+		list   string // "ul" or "ol" while in a list
+		inCode bool
+	)
+	flushPara := func() {
+		if len(para) > 0 {
+			fmt.Fprintf(buf, "<p>%s</p>\n", renderInline(strings.Join(para, "\n")))
+			para = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			fmt.Fprintf(buf, "</%s>\n", list)
+			list = ""
+		}
+	}
+	openList := func(kind string) {
+		if list != kind {
+			closeList()
+			fmt.Fprintf(buf, "<%s>\n", kind)
+			list = kind
+		}
+	}
+
+	for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		if strings.HasPrefix(line, "```") {
+			flushPara()
+			closeList()
+			if inCode {
+				buf.WriteString("</code></pre>\n")
+			} else {
+				buf.WriteString("<pre><code>")
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			buf.WriteString(html.EscapeString(line) + "\n")
+			continue
+		}
+
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			flushPara()
+			closeList()
+			fmt.Fprintf(buf, "<h%d>%s</h%d>\n", len(m[1])+1, renderInline(m[2]), len(m[1])+1)
+		} else if m := mdListItem.FindStringSubmatch(line); m != nil {
+			flushPara()
+			openList("ul")
+			fmt.Fprintf(buf, "<li>%s</li>\n", renderInline(m[1]))
+		} else if m := mdNumberItem.FindStringSubmatch(line); m != nil {
+			flushPara()
+			openList("ol")
+			fmt.Fprintf(buf, "<li>%s</li>\n", renderInline(m[1]))
+		} else if strings.HasPrefix(line, ">") {
+			flushPara()
+			closeList()
+			fmt.Fprintf(buf, "<blockquote>%s</blockquote>\n", renderInline(strings.TrimSpace(line[1:])))
+		} else if strings.TrimSpace(line) == "" {
+			flushPara()
+			closeList()
+		} else {
+			closeList()
+			para = append(para, line)
+		}
+	}
+	flushPara()
+	closeList()
+	if inCode {
+		buf.WriteString("</code></pre>\n")
+	}
+	return buf.String()
+}
+
+func renderInline(s string) string {
+	s = html.EscapeString(s)
+	s = mdCode.ReplaceAllString(s, "<code>$1</code>")
+	s = mdEscLink.ReplaceAllString(s, `<a href="$2">$1</a>`)
+	s = mdEscAutoLink.ReplaceAllString(s, `<a href="$1">$1</a>`)
+	s = mdStrong.ReplaceAllString(s, "<strong>$1</strong>")
+	s = mdEm.ReplaceAllString(s, "<em>$1</em>")
+	return strings.Replace(s, "\n", "<br>\n", -1)
+}
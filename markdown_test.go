@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckPost(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"fine", "Volume 3 is out!\n\n- [Download](https://example.com/v03.zip)\n- [Read](/release/4)\n- <mailto:us@example.com>\n- [Top](#top)\n", nil},
+		{"link title", `[Download](https://example.com/v03.zip "the archive")`, nil},
+		{"empty", "", []string{"the body is empty"}},
+		{"blank", " \n\t\n", []string{"the body is empty"}},
+		{"too long", strings.Repeat("ä", maxPostLength+1), []string{"the body is 20001 characters long (at most 20000)"}},
+		{"longest", strings.Repeat("ä", maxPostLength), nil},
+		{"placeholder", "Chapter {{.Num}} is out", []string{"line 1: template placeholder left over"}},
+		{"half a placeholder", "fine\n.Title}} is out", []string{"line 2: template placeholder left over"}},
+		{"no value", "Volume <no value> is out", []string{"line 1: template value missing (<no value>)"}},
+		{"relative", "[Download](v03.zip)", []string{`line 1: link "v03.zip": relative URL (use a full http:// or https:// URL)`}},
+		{"no URL", "[Download]()", []string{`line 1: link "": no URL`}},
+		{"no host", "[Download](https://)", []string{`line 1: link "https://": no host`}},
+		{"no address", "<mailto:>", []string{`line 1: link "mailto:": no address`}},
+		{"scheme", "<ftp://example.com/v03.zip>", []string{`line 1: link "ftp://example.com/v03.zip": unsupported scheme ftp`}},
+		{"bad URL", "[Download](https://example.com/%zz)", []string{`line 1: link "https://example.com/%zz": parse "https://example.com/%zz": invalid URL escape "%zz"`}},
+		{"unclosed", "[Download](https://example.com/v03.zip", []string{"line 1: link isn't closed with )"}},
+		{
+			"several",
+			"{{.Title}}\n[a](b) and [c](https://example.com/c\n",
+			[]string{
+				"line 1: template placeholder left over",
+				`line 2: link "b": relative URL (use a full http:// or https:// URL)`,
+				"line 2: link isn't closed with )",
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := checkPost(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: checkPost = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"paragraphs", "one\ntwo\n\nthree", "<p>one<br>\ntwo</p>\n<p>three</p>\n"},
+		{"crlf", "one\r\ntwo\r\n\r\nthree", "<p>one<br>\ntwo</p>\n<p>three</p>\n"},
+		{"headings", "# Title\n### Small", "<h2>Title</h2>\n<h4>Small</h4>\n"},
+		{"not a heading", "#hashtag", "<p>#hashtag</p>\n"},
+		{"list", "- one\n* two\n+ three", "<ul>\n<li>one</li>\n<li>two</li>\n<li>three</li>\n</ul>\n"},
+		{"numbered", "1. one\n2) two", "<ol>\n<li>one</li>\n<li>two</li>\n</ol>\n"},
+		{"lists", "- a\n1. b\n\ntext", "<ul>\n<li>a</li>\n</ul>\n<ol>\n<li>b</li>\n</ol>\n<p>text</p>\n"},
+		{"list after text", "text\n- a", "<p>text</p>\n<ul>\n<li>a</li>\n</ul>\n"},
+		{"quote", "> quoted *text*", "<blockquote>quoted <em>text</em></blockquote>\n"},
+		{"code block", "```\n<b>**x**</b>\n```\nafter", "<pre><code>&lt;b&gt;**x**&lt;/b&gt;\n</code></pre>\n<p>after</p>\n"},
+		{"unclosed code block", "```\ncode", "<pre><code>code\n</code></pre>\n"},
+		{"inline", "**bold** *em* `<code>`", "<p><strong>bold</strong> <em>em</em> <code>&lt;code&gt;</code></p>\n"},
+		{"links", `[the "v03" archive](https://example.com/v03.zip?a=1&b=2 "title") <https://example.com>`,
+			`<p><a href="https://example.com/v03.zip?a=1&amp;b=2">the &#34;v03&#34; archive</a> <a href="https://example.com">https://example.com</a></p>` + "\n"},
+		{"escaped", `<script>alert("x")</script> & more`, "<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; more</p>\n"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		if got := renderMarkdown(tt.text); got != tt.want {
+			t.Errorf("%s: renderMarkdown(%q) =\n%s\nwant\n%s", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPreviewHTML(t *testing.T) {
+	got := previewHTML(`Volume 3 <"out">`, "text")
+	for _, want := range []string{
+		"<title>Volume 3 &lt;&#34;out&#34;&gt;</title>",
+		"<h1>Volume 3 &lt;&#34;out&#34;&gt;</h1>",
+		"<p>text</p>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("preview lacks %s:\n%s", want, got)
+		}
+	}
+}
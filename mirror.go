@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"ktkr.us/pkg/dn2/manga"
+
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/mirror"
+	"ktkr.us/pkg/manga/util"
+)
+
+// mirrorUploader copies a release's archives, cover and thumbnail into a
+// mirror and records them in its index.
+type mirrorUploader struct {
+	name  string
+	dest  *core.MirrorDest
+	m     *mirror.Mirror
+	id    core.Identifier
+	files []string
+	entry *mirror.Entry
+}
+
+func newMirrorUploader(name string, dest *core.MirrorDest) *mirrorUploader {
+	return &mirrorUploader{name: name, dest: dest}
+}
+
+func (u *mirrorUploader) Name() string { return u.name }
+
+func (u *mirrorUploader) Prepare(id core.Identifier) error {
+	if u.dest.Dir == "" {
+		return fmt.Errorf("no Dir set for mirror %s", u.name)
+	}
+	u.id = id
+
+	fs := mirror.Local(u.dest.Dir)
+	if u.dest.Host != "" {
+		fs = mirror.SSH(u.dest.Host, u.dest.Dir)
+	}
+	u.m = &mirror.Mirror{FS: fs}
+
+	fi, err := core.FirstArchive(id)
+	if err != nil {
+		return err
+	}
+	u.files = []string{util.Rooted(fi.Name())}
+
+	if id.Kind == manga.Volume {
+		if _, err := os.Stat(util.Rooted(id.String(), "Splitfile")); err == nil {
+			for _, chap := range core.ParseSplits(id) {
+				name := util.Rooted(chap.ZipName())
+				if _, err := os.Stat(name); err == nil {
+					u.files = append(u.files, name)
+				}
+			}
+		}
+	}
+	for _, name := range coverFiles(id) {
+		if _, err := os.Stat(name); err == nil {
+			u.files = append(u.files, name)
+		}
+	}
+
+	if *globalDryRun {
+		for _, name := range u.files {
+			plan("copy %s to %s", filepath.Base(name), u.where(u.mirrorPath(name)))
+		}
+		plan("record %v in %s", id, u.where(mirror.IndexName))
+	}
+	return nil
+}
+
+// mirrorPath returns where the local file name goes in the mirror.
+func (u *mirrorUploader) mirrorPath(name string) string {
+	return path.Join(core.Config.Title, u.id.String(), filepath.Base(name))
+}
+
+// where describes the location of name in the mirror.
+func (u *mirrorUploader) where(name string) string {
+	full := path.Join(u.dest.Dir, name)
+	if u.dest.Host != "" {
+		return u.dest.Host + ":" + full
+	}
+	return full
+}
+
+func (u *mirrorUploader) Upload(p chan string) error {
+	u.entry = &mirror.Entry{
+		Series:     core.Config.Title,
+		Identifier: u.id.String(),
+	}
+	for _, name := range u.files {
+		p <- "Copying " + filepath.Base(name) + "..."
+		f, err := u.m.Put(u.mirrorPath(name), name, p)
+		if err != nil {
+			return err
+		}
+		u.entry.Files = append(u.entry.Files, f)
+	}
+	return nil
+}
+
+// Post records the release in the mirror's index.
+func (u *mirrorUploader) Post() error {
+	u.entry.Mirrored = time.Now()
+	return u.m.Record(u.entry)
+}
+
+func (u *mirrorUploader) URL() string {
+	return u.where(path.Join(core.Config.Title, u.id.String()))
+}
@@ -0,0 +1,158 @@
+package mirror
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FS is where a mirror keeps its files. Names are slash separated and relative
+// to the top of the mirror.
+type FS interface {
+	MkdirAll(dir string) error
+	Create(name string) (io.WriteCloser, error)
+	Open(name string) (io.ReadCloser, error) // fails with os.ErrNotExist if name doesn't exist
+	Rename(oldname, newname string) error
+}
+
+// Local returns an FS for the directory root on the local filesystem.
+func Local(root string) FS {
+	return localFS(root)
+}
+
+type localFS string
+
+func (fs localFS) path(name string) string {
+	return filepath.Join(string(fs), filepath.FromSlash(name))
+}
+
+func (fs localFS) MkdirAll(dir string) error {
+	return os.MkdirAll(fs.path(dir), 0755)
+}
+
+func (fs localFS) Create(name string) (io.WriteCloser, error) {
+	return os.Create(fs.path(name))
+}
+
+func (fs localFS) Open(name string) (io.ReadCloser, error) {
+	return os.Open(fs.path(name))
+}
+
+func (fs localFS) Rename(oldname, newname string) error {
+	return os.Rename(fs.path(oldname), fs.path(newname))
+}
+
+// SSH returns an FS for the directory root on host, which is anything ssh(1)
+// accepts, such as user@example.com or a Host from ~/.ssh/config. It runs
+// the system's ssh for every operation, so host keys and logins work as they
+// do in the shell.
+func SSH(host, root string) FS {
+	return &sshFS{host: host, root: root}
+}
+
+type sshFS struct {
+	host, root string
+}
+
+func (fs *sshFS) path(name string) string {
+	return quote(path.Join(fs.root, name))
+}
+
+func (fs *sshFS) run(script string) error {
+	_, err := fs.status(script)
+	return err
+}
+
+// status runs script on the host, returning its exit status as well as an
+// error if it failed. The status is -1 if the script couldn't be run at all.
+func (fs *sshFS) status(script string) (int, error) {
+	cmd := exec.Command("ssh", fs.host, script)
+	buf := new(bytes.Buffer)
+	cmd.Stderr = buf
+	if err := cmd.Run(); err != nil {
+		code := -1
+		if e, ok := err.(*exec.ExitError); ok {
+			code = e.ExitCode()
+		}
+		return code, fmt.Errorf("ssh %s: %v: %s", fs.host, err, bytes.TrimSpace(buf.Bytes()))
+	}
+	return 0, nil
+}
+
+func (fs *sshFS) MkdirAll(dir string) error {
+	return fs.run("mkdir -p " + fs.path(dir))
+}
+
+func (fs *sshFS) Create(name string) (io.WriteCloser, error) {
+	cmd := exec.Command("ssh", fs.host, "cat > "+fs.path(name))
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	return fs.start(cmd, w)
+}
+
+func (fs *sshFS) Open(name string) (io.ReadCloser, error) {
+	// test exits with 1 if the file is missing, and ssh with 255 if it
+	// can't connect or log in, which mustn't be taken for a missing file
+	if code, err := fs.status("test -e " + fs.path(name)); code == 1 {
+		return nil, &os.PathError{Op: "open", Path: fs.host + ":" + path.Join(fs.root, name), Err: os.ErrNotExist}
+	} else if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("ssh", fs.host, "cat "+fs.path(name))
+	r, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	return fs.start(cmd, r)
+}
+
+func (fs *sshFS) Rename(oldname, newname string) error {
+	return fs.run("mv -f " + fs.path(oldname) + " " + fs.path(newname))
+}
+
+func (fs *sshFS) start(cmd *exec.Cmd, pipe io.Closer) (*sshPipe, error) {
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &sshPipe{cmd: cmd, pipe: pipe, stderr: stderr, host: fs.host}, nil
+}
+
+// sshPipe is the standard input or output of a running ssh command. Closing
+// it waits for the command to exit.
+type sshPipe struct {
+	cmd    *exec.Cmd
+	pipe   io.Closer
+	stderr *bytes.Buffer
+	host   string
+}
+
+func (p *sshPipe) Read(b []byte) (int, error) {
+	return p.pipe.(io.Reader).Read(b)
+}
+
+func (p *sshPipe) Write(b []byte) (int, error) {
+	return p.pipe.(io.Writer).Write(b)
+}
+
+func (p *sshPipe) Close() error {
+	p.pipe.Close()
+	if err := p.cmd.Wait(); err != nil {
+		return fmt.Errorf("ssh %s: %v: %s", p.host, err, bytes.TrimSpace(p.stderr.Bytes()))
+	}
+	return nil
+}
+
+// quote quotes s for the remote shell.
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,183 @@
+// Package mirror keeps copies of released archives in a directory tree on the
+// local filesystem or on another machine reached over SSH.
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/dn"
+	"ktkr.us/pkg/manga/util"
+)
+
+// IndexName is the name of the index file at the top of a mirror.
+const IndexName = "index.json"
+
+// Entry is a release in the mirror index.
+type Entry struct {
+	Series     string
+	Identifier string
+	Files      []*File
+	Mirrored   time.Time
+}
+
+// File is a mirrored file. Name is relative to the top of the mirror.
+type File struct {
+	Name     string
+	Size     util.Bytes
+	Shake256 string
+}
+
+// Mirror is a mirror kept on FS.
+type Mirror struct {
+	FS FS
+}
+
+// Put copies the local file src to name in the mirror, sending progress to p
+// if it isn't nil. The copy is written next to name first and only renamed
+// into place once its SHAKE256 hash, computed the same way as for uploads to
+// the download server, matches src's.
+func (m *Mirror) Put(name, src string, p chan string) (*File, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	sum, err := dn.Shake256(f)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if err = m.FS.MkdirAll(path.Dir(name)); err != nil {
+		return nil, err
+	}
+	part := name + ".part"
+	if err = m.copy(part, f, util.Bytes(fi.Size()), p); err != nil {
+		return nil, err
+	}
+
+	r, err := m.FS.Open(part)
+	if err != nil {
+		return nil, err
+	}
+	got, err := dn.Shake256(r)
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("verifying %s: %v", part, err)
+	}
+	if got != sum {
+		return nil, fmt.Errorf("%s: hash of the copy doesn't match (left in %s)", name, part)
+	}
+
+	if err = m.FS.Rename(part, name); err != nil {
+		return nil, err
+	}
+	return &File{Name: name, Size: util.Bytes(fi.Size()), Shake256: sum}, nil
+}
+
+func (m *Mirror) copy(name string, r io.Reader, size util.Bytes, p chan string) error {
+	if p == nil {
+		p = make(chan string)
+		go func() {
+			for range p {
+			}
+		}()
+		defer close(p)
+	}
+
+	w, err := m.FS.Create(name)
+	if err != nil {
+		return err
+	}
+
+	sw := util.NewStatWriter(w, 16, 250*time.Millisecond, size, p)
+	done := make(chan error)
+	go func() {
+		_, err := io.Copy(sw, r)
+		done <- err
+	}()
+	err = sw.Report(done)
+
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// identLess orders identifiers as core.Identifier does, so that v2 comes
+// before v10. Anything that isn't an identifier sorts after them by name.
+func identLess(a, b string) bool {
+	ia, erra := core.ParseIdentifier(a)
+	ib, errb := core.ParseIdentifier(b)
+	switch {
+	case erra == nil && errb == nil:
+		return ia.Less(ib)
+	case erra == nil || errb == nil:
+		return erra == nil
+	}
+	return a < b
+}
+
+// Index reads the mirror's index. A mirror without one has an empty index.
+func (m *Mirror) Index() ([]*Entry, error) {
+	r, err := m.FS.Open(IndexName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var entries []*Entry
+	if err = json.NewDecoder(r).Decode(&entries); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", IndexName, err)
+	}
+	return entries, nil
+}
+
+// Record adds e to the index, replacing any entry for the same release.
+func (m *Mirror) Record(e *Entry) error {
+	entries, err := m.Index()
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i, old := range entries {
+		if old.Series == e.Series && old.Identifier == e.Identifier {
+			entries[i] = e
+			replaced = true
+		}
+	}
+	if !replaced {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Series != entries[j].Series {
+			return entries[i].Series < entries[j].Series
+		}
+		return identLess(entries[i].Identifier, entries[j].Identifier)
+	})
+
+	buf, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return err
+	}
+	return core.WriteFileFS(m.FS, IndexName, buf)
+}
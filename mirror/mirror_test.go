@@ -0,0 +1,179 @@
+package mirror
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"ktkr.us/pkg/manga/dn"
+)
+
+func writeFile(t *testing.T, data []byte) string {
+	path := filepath.Join(t.TempDir(), "src.zip")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPut(t *testing.T) {
+	root := t.TempDir()
+	m := &Mirror{FS: Local(root)}
+	data := bytes.Repeat([]byte("page data "), 10000)
+	src := writeFile(t, data)
+
+	f, err := m.Put("Title/v01/Title v01 [G].zip", src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum, _ := dn.Shake256(bytes.NewReader(data))
+	if f.Name != "Title/v01/Title v01 [G].zip" || int(f.Size) != len(data) || f.Shake256 != sum {
+		t.Errorf("Put returned %+v", f)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(root, "Title", "v01", "Title v01 [G].zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("copy differs from the source")
+	}
+	if _, err = os.Stat(filepath.Join(root, "Title", "v01", "Title v01 [G].zip.part")); !os.IsNotExist(err) {
+		t.Errorf("partial copy left behind (%v)", err)
+	}
+}
+
+// corruptFS flips the first byte of every file written through it.
+type corruptFS struct{ FS }
+
+func (fs corruptFS) Create(name string) (io.WriteCloser, error) {
+	w, err := fs.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &corruptWriter{w: w}, nil
+}
+
+type corruptWriter struct {
+	w    io.WriteCloser
+	done bool
+}
+
+func (c *corruptWriter) Write(p []byte) (int, error) {
+	if !c.done && len(p) > 0 {
+		p = append([]byte{p[0] ^ 0xff}, p[1:]...)
+		c.done = true
+	}
+	return c.w.Write(p)
+}
+
+func (c *corruptWriter) Close() error { return c.w.Close() }
+
+func TestPutHashMismatch(t *testing.T) {
+	root := t.TempDir()
+	m := &Mirror{FS: corruptFS{Local(root)}}
+	src := writeFile(t, []byte("archive"))
+
+	if _, err := m.Put("Title/v01/a.zip", src, nil); err == nil {
+		t.Fatal("Put succeeded with a corrupted copy")
+	}
+	if _, err := os.Stat(filepath.Join(root, "Title", "v01", "a.zip")); !os.IsNotExist(err) {
+		t.Errorf("corrupted copy renamed into place (%v)", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "Title", "v01", "a.zip.part")); err != nil {
+		t.Errorf("corrupted copy not kept for inspection: %v", err)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	m := &Mirror{FS: Local(t.TempDir())}
+
+	entries, err := m.Index()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("empty mirror has index %v (%v)", entries, err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	file := &File{Name: "B/v02/b.zip", Size: 10, Shake256: "old"}
+	for _, e := range []*Entry{
+		{Series: "B", Identifier: "v10", Mirrored: now},
+		{Series: "B", Identifier: "v02", Files: []*File{file}, Mirrored: now},
+		{Series: "A", Identifier: "c03", Mirrored: now},
+		{Series: "B", Identifier: "c01", Mirrored: now},
+		{Series: "B", Identifier: "v01-v05", Mirrored: now},
+	} {
+		if err = m.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// recording a release again replaces its entry
+	file = &File{Name: "B/v02/b.zip", Size: 12, Shake256: "new"}
+	if err = m.Record(&Entry{Series: "B", Identifier: "v02", Files: []*File{file}, Mirrored: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, err = m.Index(); err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, e := range entries {
+		order = append(order, e.Series+" "+e.Identifier)
+	}
+	want := []string{"A c03", "B v02", "B v10", "B c01", "B v01-v05"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("index order %q, want %q", order, want)
+	}
+	if got := entries[1].Files; len(got) != 1 || !reflect.DeepEqual(got[0], file) {
+		t.Errorf("v02 files = %+v, want the replacement", got)
+	}
+	if !entries[0].Mirrored.Equal(now) {
+		t.Errorf("mirrored time %v, want %v", entries[0].Mirrored, now)
+	}
+}
+
+// fakeSSH puts an ssh on $PATH that runs script, given the remote command as
+// $2, instead of connecting anywhere.
+func fakeSSH(t *testing.T, script string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell")
+	}
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "ssh"), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSSHOpen(t *testing.T) {
+	fs := SSH("host", "/srv")
+
+	// the file is missing
+	fakeSSH(t, "exit 1\n")
+	if _, err := fs.Open("index.json"); !os.IsNotExist(err) {
+		t.Errorf("missing file: got %v, want a not exist error", err)
+	}
+
+	// ssh can't log in; the index mustn't be taken for empty
+	fakeSSH(t, "echo 'Permission denied (publickey).' >&2\nexit 255\n")
+	m := &Mirror{FS: fs}
+	if _, err := m.Index(); err == nil || os.IsNotExist(err) || !strings.Contains(err.Error(), "Permission denied") {
+		t.Errorf("failed login: got %v", err)
+	}
+	if err := m.Record(&Entry{Series: "A", Identifier: "v01"}); err == nil {
+		t.Error("recorded an entry over an index that couldn't be read")
+	}
+
+	fakeSSH(t, "case \"$2\" in test*) exit 0;; esac\necho '[{\"Series\": \"A\", \"Identifier\": \"v01\"}]'\n")
+	entries, err := m.Index()
+	if err != nil || len(entries) != 1 || entries[0].Identifier != "v01" {
+		t.Errorf("index = %v (%v)", entries, err)
+	}
+}
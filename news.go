@@ -2,113 +2,709 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
+	"unicode"
 
 	"ktkr.us/pkg/dn2/manga"
 
 	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/dn"
 	"ktkr.us/pkg/manga/util"
 )
 
 var cmdNews = &Command{
 	Name:    "news",
-	Summary: "[-u | <title> ]",
+	Summary: "list | edit <id> | delete <id> | draft <title> | publish <draft> | -resume [<draft>] | [post] [-F <file>] [-u | [-i <identifier>] <title> ]",
 	Help: `
-Post or update news.`,
-	Flags: flag.NewFlagSet("news", flag.ExitOnError),
-}
+Post or update news.
 
-func init() {
-	cmdNews.Run = doNews
+Without an action, a new post with the given title is written and posted
+right away, or with -u, the latest post is edited. A title whose first word is
+one of the actions below has to be given after the post action, as in
+"manga news post publish schedule".
+
+Actions:
+  post     Write and post a new post with the given title, as without an
+           action.
+  list     List the posts on the server and the local drafts.
+  edit     Edit the post with the given id.
+  delete   Delete the post with the given id after confirmation.
+  draft    Write a post without posting it. Drafts are kept in .drafts/news
+           under a name made from the title, which is printed; giving the
+           name of a draft instead of a title edits it again.
+  publish  Post the draft with the given name and remove it.
+
+Posts being written are kept as drafts too, until they have been posted, so
+nothing is lost if posting fails or the post is turned down at the preview.
+-resume edits the draft with the given name, or the one changed last, again
+and posts it. Drafts of edits to existing posts are named post-<id> and carry
+the id of the post in their front matter.
+
+Posts are edited with a header of front matter above the body:
+
+    ---
+    title: Volume 3 is out
+    tags: release, volume
+    date: 2006-01-02 15:04
+    ---
+
+The title, tags and publish date are read back from it when saving. The date
+may be left empty to publish right away, or given in the future to have the
+server publish the post then. The front matter is read from a file given with
+-F too, if it starts with one.
+
+If the series has a templates/news.txt, new posts start out as that Go
+text/template, executed with the post title and the series title. With -i, the
+same information about the identifier as for release notes is available too.
+
+Posts are checked and, when edited in $EDITOR, previewed and confirmed the
+same way as release notes (see the README) before they are posted. Drafts are
+checked when they are published.
+
+New posts are announced to the webhooks in .manga (see the README), except
+scheduled ones.`,
+	Flags: flag.NewFlagSet("news", flag.ExitOnError),
 }
 
 var (
 	newsU = cmdNews.Flags.Bool("u", false, "Update last post instead of creating")
+	newsF = cmdNews.Flags.String("F", "", "Read the post body from `\033[4mFILE\033[m` (- for stdin) instead of $EDITOR")
+	newsI = cmdNews.Flags.String("i", "", "Fill in the news template for `\033[4mIDENTIFIER\033[m`")
+
+	newsResume = cmdNews.Flags.Bool("resume", false, "Edit and post a draft left by a failed post, or the latest draft")
 )
 
+var newsActions map[string]func(cmd *Command, args []string)
+
+func init() {
+	cmdNews.Run = doNews
+	newsActions = map[string]func(cmd *Command, args []string){
+		"list":    newsList,
+		"edit":    newsEdit,
+		"delete":  newsDelete,
+		"draft":   newsDraft,
+		"publish": newsPublish,
+		"post":    newsPost,
+	}
+}
+
 func doNews(cmd *Command, args []string) {
-	tmpName := "manga-newspost_" + time.Now().Format("2006-01-02_15_04_05")
-	tmpPath := filepath.Join(os.TempDir(), tmpName)
-	file, err := os.Create(tmpPath)
+	core.LoadConfig()
+	if len(args) > 0 {
+		if action, ok := newsActions[args[0]]; ok {
+			// allow flags after the action too
+			cmd.Flags.Parse(args[1:])
+			action(cmd, cmd.Flags.Args())
+			return
+		}
+	}
+	if *newsResume {
+		newsResumeDraft(cmd, args)
+		return
+	}
+	newsPost(cmd, args)
+}
+
+// newsPost writes a new post with the title args, or with -u edits the latest
+// post, and posts it.
+func newsPost(cmd *Command, args []string) {
+	if *globalDryRun {
+		planNews(cmd, args)
+		return
+	}
+
+	client, err := dn.Default()
 	if err != nil {
 		cmd.Fatal(err)
 	}
-	news := new(manga.NewsPost)
+
+	news := new(dn.NewsPost)
+	var name string
 	if *newsU {
-		resp, err := http.Get("http://" + core.Config.Remote + "/news")
-		if err != nil {
+		if news, err = client.LatestNews(); err != nil {
 			cmd.Fatalln("getting news:", err)
 		}
+		name = editDraftName(news.Id)
+	} else {
+		if len(args) < 1 {
+			cmd.Fatal("title required")
+		}
+		news.Title = strings.Join(args, " ")
+		if news.Body, err = newsTemplate(cmd, news.Title); err != nil {
+			cmd.Fatal("news template: ", err)
+		}
+		name = newsSlug(news.Title)
+	}
 
-		if resp.StatusCode >= 400 {
-			e := new(Error)
-			if err = json.NewDecoder(resp.Body).Decode(e); err != nil {
-				cmd.Fatal(err)
-			}
-			cmd.Fatal(e)
+	checkNoDraft(cmd, name)
+	editNews(cmd, news, name, editPost)
+	postNews(cmd, client, news, name)
+}
+
+// How editNews treats a post.
+type editMode int
+
+const (
+	editPost   editMode = iota // check, preview and confirm it; abort if left unchanged
+	editResume                 // the same, but it may be posted unchanged
+	editDraft                  // only save it
+)
+
+// editNews fills in news from the file given with -F or by editing it, with
+// its front matter, in $EDITOR. The file edited is the draft with the given
+// name, which is left in place. Unless only saving a draft, the body is
+// checked in any case, and edits are previewed before going on.
+func editNews(cmd *Command, news *dn.NewsPost, name string, mode editMode) {
+	switch {
+	case *newsF != "":
+		body, err := util.ReadBody(*newsF)
+		if err != nil {
+			cmd.Fatalln("reading post body:", err)
 		}
-		if err = json.NewDecoder(resp.Body).Decode(news); err != nil {
+		if err = parseNews(body, news); err != nil {
 			cmd.Fatal(err)
 		}
-
-		if _, err := file.Write([]byte(news.Body)); err != nil {
-			cmd.Fatalln("writing post body:", err)
+		if mode != editDraft {
+			validatePost(cmd, news.Body)
 		}
-		file.Seek(0, os.SEEK_SET)
-	} else {
-		if len(args) < 1 {
-			cmd.Fatal("title required")
+		return
+	case util.NoInput && news.Body == "":
+		cmd.Fatal("no post body given (use -F with -no-input)")
+	case util.NoInput:
+		// take the template as is
+		if mode != editDraft {
+			validatePost(cmd, news.Body)
 		}
-		news.Title = strings.Join(args, " ")
+		return
+	}
+
+	initial := formatNews(news)
+	if err := core.SaveDraft(core.NewsDraft, name, initial); err != nil {
+		cmd.Fatalln("writing post body:", err)
 	}
 
 	// edit in $EDITOR
-	util.Launch(util.GetEditor(), file.Name())
+	util.Launch(util.GetEditor(), core.DraftPath(core.NewsDraft, name))
 
-	// read and post it back
-	buf := new(bytes.Buffer)
-	if _, err = io.Copy(buf, file); err != nil {
+	body, err := core.LoadDraft(core.NewsDraft, name)
+	if err != nil {
 		cmd.Fatalln("reading post body:", err)
 	}
+	if body == initial && mode == editPost {
+		core.RemoveDraft(core.NewsDraft, name)
+		cmd.Fatal("nothing changed in the editor; abort")
+	}
+	if err = parseNews(body, news); err != nil {
+		cmd.Fatalf("%v (the post is saved as draft %s)", err, name)
+	}
+	if mode == editDraft {
+		return
+	}
+	if err = reviewPost(cmd, news.Title, news.Body); err != nil {
+		cmd.Fatalf("%v (the post is saved as draft %s; continue with manga news -resume %s)", err, name, name)
+	}
+}
 
-	news.Body = buf.String()
+// postNews creates news, or updates it if it has an id, and records it. If
+// posting fails, news is saved as the draft with the given name to be tried
+// again with -resume; otherwise that draft is removed.
+func postNews(cmd *Command, client *dn.Client, news *dn.NewsPost, name string) {
+	update := news.Id != 0
 
-	buf.Reset()
-	if err = json.NewEncoder(buf).Encode(news); err != nil {
+	var (
+		posted *dn.NewsPost
+		err    error
+	)
+	if update {
+		posted, err = client.UpdateNews(news)
+	} else {
+		posted, err = client.CreateNews(news)
+	}
+	if err != nil {
+		if serr := core.SaveDraft(core.NewsDraft, name, formatNews(news)); serr != nil {
+			cmd.Fatalf("posting news: %v (and saving it as a draft: %v)", err, serr)
+		}
+		cmd.Fatalf("posting news: %v (the post is saved as draft %s; try again with manga news -resume %s)", err, name, name)
+	}
+
+	if update {
+		fmt.Printf("Updated post #%d\n", posted.Id)
+	} else {
+		fmt.Printf("Created post #%d\n", posted.Id)
+	}
+	if err = core.RemoveDraft(core.NewsDraft, name); err != nil {
+		cmd.Print(err)
+	}
+
+	if err = recordNews(posted, update); err != nil {
+		cmd.Fatal("recording news post: ", err)
+	}
+	if !update && !scheduled(posted) {
+		newsHooks(cmd, posted)
+	}
+}
+
+// scheduled reports whether news is to be published by the server later, in
+// which case the webhooks aren't notified of it.
+func scheduled(news *dn.NewsPost) bool {
+	return news.PublishAt != nil && news.PublishAt.After(time.Now())
+}
+
+// editDraftName returns the name of the draft kept while editing the post
+// with the given id.
+func editDraftName(id int) string {
+	return "post-" + strconv.Itoa(id)
+}
+
+// checkNoDraft exits if there is a draft with the given name already, so
+// that it isn't overwritten.
+func checkNoDraft(cmd *Command, name string) {
+	if _, err := os.Stat(core.DraftPath(core.NewsDraft, name)); err == nil {
+		cmd.Fatalf("there is a draft named %s already (continue it with manga news -resume %s)", name, name)
+	}
+}
+
+// loadDraft reads and parses the news draft with the given name.
+func loadDraft(cmd *Command, name string) *dn.NewsPost {
+	text, err := core.LoadDraft(core.NewsDraft, name)
+	if os.IsNotExist(err) {
+		cmd.Fatalf("no draft named %s (see manga news list)", name)
+	} else if err != nil {
 		cmd.Fatal(err)
 	}
+	news := new(dn.NewsPost)
+	if err = parseNews(text, news); err != nil {
+		cmd.Fatalf("%v (in %s)", err, core.DraftPath(core.NewsDraft, name))
+	}
+	return news
+}
 
-	var endpoint string
-	if *newsU {
-		endpoint = "/news/update"
+// planPost prints the request postNews would make for news.
+func planPost(client *dn.Client, news *dn.NewsPost, source string) {
+	if news.Id != 0 {
+		plan("POST %s/news/update  post #%d, body from %s", client.BaseURL, news.Id, source)
 	} else {
-		endpoint = "/news/create"
+		plan("POST %s/news/create  title=%q, body from %s", client.BaseURL, news.Title, source)
+	}
+}
+
+const frontMatterDelim = "---"
+
+// formatNews returns news as front matter followed by the body.
+func formatNews(news *dn.NewsPost) string {
+	var date string
+	if news.PublishAt != nil {
+		date = news.PublishAt.Local().Format("2006-01-02 15:04")
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintln(buf, frontMatterDelim)
+	if news.Id != 0 {
+		fmt.Fprintf(buf, "id: %d\n", news.Id)
 	}
-	resp, err := http.Post("http://"+core.Config.Remote+endpoint, "application/json", buf)
+	fmt.Fprintf(buf, "title: %s\n", news.Title)
+	fmt.Fprintf(buf, "tags: %s\n", strings.Join(news.Tags, ", "))
+	fmt.Fprintf(buf, "date: %s\n", date)
+	fmt.Fprintln(buf, frontMatterDelim)
+	buf.WriteString(news.Body)
+	return buf.String()
+}
+
+// parseNews sets the body of news from text, and its title, tags and publish
+// time, and the id of the post it edits, from the front matter text starts
+// with, if any.
+func parseNews(text string, news *dn.NewsPost) error {
+	lines := strings.SplitAfter(text, "\n")
+	if strings.TrimSpace(lines[0]) != frontMatterDelim {
+		news.Body = text
+		return nil
+	}
+
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == frontMatterDelim {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return fmt.Errorf("front matter isn't closed with %s", frontMatterDelim)
+	}
+
+	for i, line := range lines[1:end] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			return fmt.Errorf("front matter line %d: expected \"key: value\"", i+2)
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:colon]))
+		val := strings.TrimSpace(line[colon+1:])
+
+		switch key {
+		case "id":
+			id, err := strconv.Atoi(val)
+			if err != nil {
+				return fmt.Errorf("front matter line %d: invalid post id %q", i+2, val)
+			}
+			news.Id = id
+		case "title":
+			news.Title = val
+		case "tags":
+			news.Tags = nil
+			for _, tag := range strings.Split(val, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					news.Tags = append(news.Tags, tag)
+				}
+			}
+		case "date":
+			news.PublishAt = nil
+			if val != "" {
+				t, err := parsePublishTime(val)
+				if err != nil {
+					return fmt.Errorf("front matter line %d: %v", i+2, err)
+				}
+				news.PublishAt = &t
+			}
+		default:
+			return fmt.Errorf("front matter line %d: unknown key %q", i+2, key)
+		}
+	}
+
+	if news.Title == "" {
+		return fmt.Errorf("no title given in the front matter")
+	}
+	news.Body = strings.Join(lines[end+1:], "")
+	return nil
+}
+
+// checkOneArg stops actions that take a single argument from being given a
+// title, which is most likely meant to be posted.
+func checkOneArg(cmd *Command, args []string) {
+	if len(args) > 1 {
+		cmd.Fatal("too many arguments (to post a title starting with an action, use manga news post <title>)")
+	}
+}
+
+// newsID parses the post id in args.
+func newsID(cmd *Command, args []string) int {
+	if len(args) == 0 {
+		help(cmd)
+	}
+	checkOneArg(cmd, args)
+	id, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
 	if err != nil {
-		cmd.Fatalln("posting news:", err)
+		cmd.Fatalf("invalid post id %q", args[0])
+	}
+	return id
+}
+
+func newsList(cmd *Command, args []string) {
+	client, err := dn.Default()
+	if err != nil {
+		cmd.Fatal(err)
 	}
-	switch resp.StatusCode {
-	case 201:
-		json.NewDecoder(resp.Body).Decode(news)
-		fmt.Printf("Created post #%d\n", news.Id)
-		os.Remove(tmpPath)
-	case 200:
-		json.NewDecoder(resp.Body).Decode(news)
-		fmt.Printf("Updated post #%d\n", news.Id)
-		os.Remove(tmpPath)
+	drafts, err := core.Drafts(core.NewsDraft)
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	if *globalDryRun {
+		plan("GET %s/news/list", client.BaseURL)
+		return
+	}
+
+	posts, err := client.ListNews()
+	if err != nil {
+		cmd.Fatalln("listing news:", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 8, 4, 2, ' ', 0)
+	for _, n := range posts {
+		var date string
+		if n.PublishAt != nil && n.PublishAt.After(time.Now()) {
+			date = "scheduled " + n.PublishAt.Local().Format("2006-01-02 15:04")
+		} else if rec, err := core.LoadNewsRecord(n.Id); err == nil && rec != nil {
+			date = rec.Posted.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "#%d\t%s\t%s\t%s\n", n.Id, date, n.Title, strings.Join(n.Tags, ", "))
+	}
+	for _, name := range drafts {
+		draft := new(dn.NewsPost)
+		text, err := core.LoadDraft(core.NewsDraft, name)
+		if err == nil {
+			err = parseNews(text, draft)
+		}
+		if err != nil {
+			fmt.Fprintf(tw, "draft\t%s\t(%v)\t\n", name, err)
+			continue
+		}
+		fmt.Fprintf(tw, "draft\t%s\t%s\t%s\n", name, draft.Title, strings.Join(draft.Tags, ", "))
+	}
+	tw.Flush()
+}
+
+func newsEdit(cmd *Command, args []string) {
+	id := newsID(cmd, args)
+
+	client, err := dn.Default()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	if *globalDryRun {
+		plan("GET %s/news/%d", client.BaseURL, id)
+		plan("POST %s/news/update  post #%d, body from %s", client.BaseURL, id, notesSource("", *newsF))
+		return
+	}
+
+	news, err := client.News(id)
+	if err != nil {
+		cmd.Fatalln("getting news:", err)
+	}
+	name := editDraftName(id)
+	checkNoDraft(cmd, name)
+	editNews(cmd, news, name, editPost)
+	postNews(cmd, client, news, name)
+}
+
+func newsDelete(cmd *Command, args []string) {
+	id := newsID(cmd, args)
+
+	client, err := dn.Default()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	if *globalDryRun {
+		plan("POST %s/news/delete  post #%d", client.BaseURL, id)
+		return
+	}
+
+	news, err := client.News(id)
+	if err != nil {
+		cmd.Fatalln("getting news:", err)
+	}
+	if !util.Promptf("Delete news post #%d (%s)?", news.Id, news.Title) {
+		cmd.Fatal("abort")
+	}
+
+	if err = client.DeleteNews(id); err != nil {
+		cmd.Fatalln("deleting news:", err)
+	}
+	if err = core.RemoveNewsRecord(id); err != nil {
+		cmd.Fatal(err)
+	}
+	fmt.Printf("Deleted post #%d\n", id)
+}
+
+func newsDraft(cmd *Command, args []string) {
+	if len(args) == 0 {
+		help(cmd)
+	}
+
+	// an existing draft is edited again, by name or by its title
+	name := strings.Join(args, " ")
+	if _, err := os.Stat(core.DraftPath(core.NewsDraft, name)); err != nil {
+		name = newsSlug(name)
+	}
+
+	news := new(dn.NewsPost)
+	text, err := core.LoadDraft(core.NewsDraft, name)
+	switch {
+	case err == nil:
+		if err = parseNews(text, news); err != nil {
+			cmd.Fatalf("%v (in %s)", err, core.DraftPath(core.NewsDraft, name))
+		}
+	case os.IsNotExist(err):
+		news.Title = strings.Join(args, " ")
+		if news.Body, err = newsTemplate(cmd, news.Title); err != nil {
+			cmd.Fatal("news template: ", err)
+		}
 	default:
-		fmt.Println(resp.Status)
-		e := new(Error)
-		json.NewDecoder(resp.Body).Decode(e)
-		cmd.Fatal(e)
+		cmd.Fatal(err)
+	}
+
+	if *globalDryRun {
+		plan("write %s  draft %q, body from %s", core.DraftPath(core.NewsDraft, name), news.Title, notesSource("", *newsF))
+		return
+	}
+
+	editNews(cmd, news, name, editDraft)
+	if err = core.SaveDraft(core.NewsDraft, name, formatNews(news)); err != nil {
+		cmd.Fatalln("saving draft:", err)
+	}
+	fmt.Printf("Saved draft %s (post it with manga news publish %s)\n", name, name)
+}
+
+func newsPublish(cmd *Command, args []string) {
+	if len(args) == 0 {
+		help(cmd)
+	}
+	checkOneArg(cmd, args)
+	name := args[0]
+	if _, err := os.Stat(core.DraftPath(core.NewsDraft, name)); os.IsNotExist(err) {
+		cmd.Fatalf("no draft named %s (see manga news list; to post a title starting with publish, use manga news post <title>)", name)
+	}
+	news := loadDraft(cmd, name)
+
+	client, err := dn.Default()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	if *globalDryRun {
+		planPost(client, news, core.DraftPath(core.NewsDraft, name))
+		if news.Id == 0 && !scheduled(news) {
+			newsHooks(cmd, news)
+		}
+		return
+	}
+
+	if err = reviewPost(cmd, news.Title, news.Body); err != nil {
+		cmd.Fatal(err)
+	}
+	postNews(cmd, client, news, name)
+}
+
+// newsResumeDraft edits and posts the draft named in args, or the one changed
+// last.
+func newsResumeDraft(cmd *Command, args []string) {
+	var name string
+	if len(args) > 0 {
+		name = args[0]
+	} else {
+		drafts, err := core.Drafts(core.NewsDraft)
+		if err != nil {
+			cmd.Fatal(err)
+		}
+		if len(drafts) == 0 {
+			cmd.Fatal("no drafts to resume")
+		}
+		name = drafts[0]
+	}
+	news := loadDraft(cmd, name)
+
+	client, err := dn.Default()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	if *globalDryRun {
+		planPost(client, news, core.DraftPath(core.NewsDraft, name))
+		if news.Id == 0 && !scheduled(news) {
+			newsHooks(cmd, news)
+		}
+		return
+	}
+
+	editNews(cmd, news, name, editResume)
+	postNews(cmd, client, news, name)
+}
+
+// newsSlug makes a draft name out of a post title.
+func newsSlug(title string) string {
+	buf := new(bytes.Buffer)
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			dash = true
+			continue
+		}
+		if dash && buf.Len() > 0 {
+			buf.WriteByte('-')
+		}
+		dash = false
+		buf.WriteRune(r)
+	}
+	if buf.Len() == 0 {
+		return "draft"
+	}
+	return buf.String()
+}
+
+// newsHooks notifies the webhooks of a new news post.
+func newsHooks(cmd *Command, news *dn.NewsPost) {
+	var id *core.Identifier
+	if *newsI != "" {
+		i := cmd.identifier(*newsI)
+		id = &i
+	}
+	data, err := newNotesData(id)
+	if err != nil {
+		cmd.Print("webhooks: ", err)
+		return
+	}
+	data.PostTitle = news.Title
+
+	fireWebhooks(cmd, &HookData{
+		NotesData: data,
+		Event:     "news",
+		URL:       newsURL(news.Id),
+		Text:      news.Body,
+	})
+}
+
+// recordNews keeps a copy of a published news post for feeds. Scheduled
+// posts are recorded as posted at their publish time.
+func recordNews(news *dn.NewsPost, updated bool) error {
+	rec, err := core.LoadNewsRecord(news.Id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if rec == nil {
+		rec = &core.NewsRecord{Id: news.Id, Posted: now}
+	} else if updated {
+		rec.Updated = now
+	}
+	if news.PublishAt != nil && !updated {
+		rec.Posted = *news.PublishAt
+	}
+	rec.Title = news.Title
+	rec.Body = news.Body
+	rec.Tags = news.Tags
+	return rec.Save()
+}
+
+// newsTemplate renders the news template for a post titled title, about the
+// identifier given with -i if any.
+func newsTemplate(cmd *Command, title string) (string, error) {
+	var id *core.Identifier
+	if *newsI != "" {
+		i := cmd.identifier(*newsI)
+		id = &i
+	}
+	data, err := newNotesData(id)
+	if err != nil {
+		return "", err
+	}
+	data.PostTitle = title
+	return renderTemplate("news", data)
+}
+
+// planNews prints the requests doNews would make.
+func planNews(cmd *Command, args []string) {
+	body := "$EDITOR"
+	if *newsF != "" {
+		body = *newsF
+	}
+	if *newsU {
+		plan("GET http://%s/news", core.Config.Remote)
+		plan("POST http://%s/news/update  last post, body from %s", core.Config.Remote, body)
+		return
+	}
+	if len(args) < 1 {
+		cmd.Fatal("title required")
 	}
+	plan("POST http://%s/news/create  title=%q, body from %s", core.Config.Remote, strings.Join(args, " "), body)
+	newsHooks(cmd, &dn.NewsPost{NewsPost: manga.NewsPost{Title: strings.Join(args, " ")}})
 }
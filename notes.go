@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"ktkr.us/pkg/dn2/manga"
+
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/util"
+)
+
+// templateDir is the folder at the top level of the series holding the
+// release notes and news templates.
+const templateDir = "templates"
+
+// NotesData is what release notes and news post templates can refer to.
+type NotesData struct {
+	Title     string // series title
+	Shortname string
+	Group     string
+	PostTitle string // only for news posts
+
+	// The rest is only set if there is an identifier to talk about.
+	Id          *core.Identifier
+	Chapters    []*ChapterInfo // from the Splitfile, if there is one
+	Credits     []*core.Credit
+	Pages       int
+	Archive     string
+	Size        util.Bytes
+	DownloadURL string
+}
+
+// ChapterInfo describes one chapter of a volume.
+type ChapterInfo struct {
+	Num   string
+	Title string
+	Pages int
+}
+
+// newNotesData collects the template data for the series and, unless it is
+// nil, the identifier id.
+func newNotesData(id *core.Identifier) (*NotesData, error) {
+	data := &NotesData{
+		Title:     core.Config.Title,
+		Shortname: core.Config.Shortname,
+		Group:     core.Config.Group,
+		Id:        id,
+	}
+	if id == nil {
+		return data, nil
+	}
+
+	credits, err := core.Credits(*id)
+	if err != nil {
+		return nil, err
+	}
+	data.Credits = credits
+
+	if fi, err := core.FirstArchive(*id); err == nil {
+		data.Archive = fi.Name()
+		data.Size = util.Bytes(fi.Size())
+		data.Pages = zipPages(util.Rooted(fi.Name()))
+		data.DownloadURL = core.DownloadURL(fi.Name())
+	}
+
+	splitfile := filepath.Join(core.TopLevel(), id.String(), "Splitfile")
+	if _, err := os.Stat(splitfile); id.Kind == manga.Volume && err == nil {
+		for _, chap := range core.ParseSplits(*id) {
+			data.Chapters = append(data.Chapters, &ChapterInfo{
+				Num:   chap.Num,
+				Title: chap.Title,
+				Pages: zipPages(util.Rooted(chap.ZipName())),
+			})
+		}
+	}
+
+	return data, nil
+}
+
+// zipPages counts the pages in the zip archive at path. It returns 0 if the
+// archive can't be read.
+func zipPages(path string) int {
+	z, err := zip.OpenReader(path)
+	if err != nil {
+		return 0
+	}
+	defer z.Close()
+
+	n := 0
+	for _, f := range z.File {
+		if f.Name != comicInfoName {
+			n++
+		}
+	}
+	return n
+}
+
+// renderTemplate executes the template templates/<name>.txt of the series
+// with data. If there is no such template, it returns the empty string.
+func renderTemplate(name string, data interface{}) (string, error) {
+	path := util.Rooted(templateDir, name+".txt")
+	text, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return executeString(name, string(text), data)
+}
@@ -13,15 +13,36 @@ import (
 
 	"ktkr.us/pkg/manga/core"
 	"ktkr.us/pkg/manga/job"
+	"ktkr.us/pkg/manga/journal"
 	"ktkr.us/pkg/manga/util"
 )
 
 var cmdPkg = &Command{
 	Name:    "pkg",
-	Summary: "[-O] [-n] [-f] [-c] <identifier> [extra...]",
+	Summary: "[-O] [-n] [-f] [-c] [-credits] <identifier> [extra...] | -batch [-dir] [-torrent] <range> [extra...]",
 	Help: `
-Package pages into zip files.`,
-	Flags: flag.NewFlagSet("pkg", flag.ExitOnError),
+Package pages into zip files.
+
+Each archive gets a ComicInfo.xml with the series, volume and chapter numbers
+and the staff credits: the Staff roster in .manga, as changed by the Credits
+file next to the Splitfile, one "Role: Name, Name..." per line. With -credits,
+a page listing them is added to the end of each archive too.
+
+With -batch, the archives already packaged for a range of identifiers such as
+v01-v05 are bundled as they are into "<Title> v01-v05 [<Group>].zip", or into a
+directory of that name with -dir, along with a manifest.json listing each
+release's identifier, archive, size and SHAKE256 hash. With -torrent, a
+torrent of the batch is made too (see manga torrent), without web seeds, as the
+batch isn't uploaded anywhere.
+
+Spreads are found by their shape as with manga resize, and marked as double
+pages in ComicInfo.xml. -rename-spreads renames them the same way too.
+
+Pages are read from the out folder that manga resize writes to, or if it has
+none, from the closest folder before it that has some, such as res in series
+resized in place.`,
+	Flags:  flag.NewFlagSet("pkg", flag.ExitOnError),
+	Stages: core.StageIO{In: "out"},
 }
 
 var (
@@ -29,6 +50,14 @@ var (
 	pkgN = cmdPkg.Flags.Bool("n", false, "Skip splitting into individual chapter zips")
 	pkgF = cmdPkg.Flags.Bool("f", false, "Skip archives that already exist")
 	pkgC = cmdPkg.Flags.Bool("c", false, "Only package chapters, skip volume")
+
+	pkgCredits = cmdPkg.Flags.Bool("credits", false, "Add a credits page to the end of each archive")
+
+	pkgBatch   = cmdPkg.Flags.Bool("batch", false, "Bundle the archives of a range of identifiers")
+	pkgDir     = cmdPkg.Flags.Bool("dir", false, "Make the batch a directory instead of a zip")
+	pkgTorrent = cmdPkg.Flags.Bool("torrent", false, "Make a torrent of the batch")
+
+	pkgRename = cmdPkg.Flags.Bool("rename-spreads", false, "Rename pages shaped like spreads after the spread convention")
 )
 
 func init() {
@@ -42,7 +71,16 @@ func runPkg(cmd *Command, args []string) {
 		help(cmd)
 	}
 
+	if *pkgBatch {
+		runBatch(cmd, args)
+		return
+	}
+
 	id := cmd.identifier(args[0])
+	credits, err := core.Credits(id)
+	if err != nil {
+		cmd.Fatal(err)
+	}
 
 	// build zip file name
 	wd, err := os.Getwd()
@@ -52,11 +90,20 @@ func runPkg(cmd *Command, args []string) {
 
 	zipPath := filepath.Join(wd, makeZipName(id, args))
 
-	cmd.in(id.String(), "res")
-	ims := images(Page, Spread)
+	ims := cmd.inImages(id.String(), Page, Spread)
+	imageSizes(ims)
+	var j *journal.Journal
+	if *pkgRename || *pkgCredits {
+		j = cmd.journal(id.String())
+	}
+	for _, im := range detectSpreads(cmd, ims) {
+		if *pkgRename {
+			renameSpread(cmd, im, j)
+		}
+	}
 	zips := []*ZipDest{}
 	if !*pkgC {
-		zips = append(zips, &ZipDest{zipPath, ims, false})
+		zips = append(zips, &ZipDest{Name: zipPath, Images: ims, Info: newComicInfo(id, nil, credits)})
 	}
 	os.Chdir(core.TopLevel())
 
@@ -66,7 +113,20 @@ func runPkg(cmd *Command, args []string) {
 
 	if !*pkgN && id.Kind == manga.Volume {
 		chaps := core.ParseSplits(id)
-		doSplits(cmd, chaps, &zips, ims, wd)
+		doSplits(cmd, chaps, &zips, ims, credits)
+	}
+
+	if *pkgCredits && len(ims) > 0 {
+		page := creditsPage(cmd, id, credits, ims[0], j)
+		for _, zd := range zips {
+			// chapter archives share the volume's page slice
+			zd.Images = append(zd.Images[:len(zd.Images):len(zd.Images)], page)
+		}
+	}
+	j.Close()
+	for _, zd := range zips {
+		zd.Info.PageCount = len(zd.Images)
+		zd.Info.Pages = doublePages(zd.Images)
 	}
 
 	// check to see if any of the zip file names exist already
@@ -80,11 +140,24 @@ func runPkg(cmd *Command, args []string) {
 				// should make a new archive
 				cmd.Printf("file \033[4m%s\033[0m already exists", zipName)
 				cmd.Print("  (use flag -f to ignore)")
-				os.Exit(1)
+				if !*globalDryRun {
+					os.Exit(1)
+				}
 			}
 		}
 	}
 
+	if *globalDryRun {
+		for _, zd := range zips {
+			plan("%s (%d pages)", zd.Name, len(zd.Images))
+			for _, im := range zd.Images {
+				plan("    %s", im.base())
+			}
+			plan("    %s", comicInfoName)
+		}
+		return
+	}
+
 	t := make(job.Group, len(zips))
 	for i, zd := range zips {
 		t[i] = job.New(zd, filepath.Base(zd.Name))
@@ -96,16 +169,22 @@ func runPkg(cmd *Command, args []string) {
 }
 
 func makeZipName(id core.Identifier, args []string) string {
-	parts := []string{core.Config.Title, id.String()}
+	return releaseName(id.String(), args) + ".zip"
+}
+
+// releaseName names a release of ident, which may be a range of identifiers,
+// as "<Title> <ident> [extra...] [<Group>]".
+func releaseName(ident string, args []string) string {
+	parts := []string{core.Config.Title, ident}
 	if args != nil && len(args) > 1 {
 		parts = append(parts, args[1:]...)
 	}
-	parts = append(parts, "["+core.Config.Group+"].zip")
+	parts = append(parts, "["+core.Config.Group+"]")
 
 	return strings.Join(parts, " ")
 }
 
-func doSplits(cmd *Command, chaps []*core.ChapSplit, zips *[]*ZipDest, ims []*Image, wd string) {
+func doSplits(cmd *Command, chaps []*core.ChapSplit, zips *[]*ZipDest, ims []*Image, credits []*core.Credit) {
 	i, j := 0, 0
 split:
 	for n, chap := range chaps {
@@ -119,9 +198,9 @@ split:
 				}
 				if i != j {
 					*zips = append(*zips, &ZipDest{
-						util.Rooted(chap.ZipName()),
-						ims[i:j],
-						false,
+						Name:   util.Rooted(chap.ZipName()),
+						Images: ims[i:j],
+						Info:   newComicInfo(chap.Id, chap, credits),
 					})
 				}
 				i = j
@@ -134,9 +213,9 @@ split:
 
 	chap := chaps[len(chaps)-1]
 	*zips = append(*zips, &ZipDest{
-		util.Rooted(chap.ZipName()),
-		ims[i:],
-		false,
+		Name:   util.Rooted(chap.ZipName()),
+		Images: ims[i:],
+		Info:   newComicInfo(chap.Id, chap, credits),
 	})
 }
 
@@ -144,6 +223,7 @@ type ZipDest struct {
 	Name   string
 	Images []*Image
 	Skip   bool
+	Info   *ComicInfo // written as ComicInfo.xml if not nil
 }
 
 func (z *ZipDest) String() string {
@@ -183,6 +263,16 @@ func (zd *ZipDest) Begin(p chan string) error {
 		p <- fmt.Sprintf("%d / %d", i+1, len(zd.Images))
 	}
 
+	if zd.Info != nil {
+		w, err := z.Create(comicInfoName)
+		if err != nil {
+			return err
+		}
+		if _, err = zd.Info.WriteTo(w); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 func filesizes(names ...string) (totalSize util.Bytes) {
@@ -3,28 +3,50 @@ package main
 import (
 	"flag"
 	"fmt"
+	"image"
 	"math"
-	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 
 	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/journal"
+	"ktkr.us/pkg/manga/util"
 )
 
 var cmdPrep = &Command{
 	Name:    "prep",
-	Summary: "[-d] [-s n₁-m₁[,n₂-m₂...]] { <identifier> | -x <files...> }",
+	Summary: "[-d | -c] [-in-place] [-s n₁-m₁[,n₂-m₂...]] { <identifier> | -x <files...> }",
 	Help: `
 Rotate and split sideways double pages from scanner. Pages such as from
 doujinshi which are only one page per image need not be rotated and split up,
 so use -d. If -d is not specified, the list of spreads from -spreads will be
-unsplit, just rotated and named accordingly.`,
-	Flags: flag.NewFlagSet("prep", flag.ExitOnError),
+unsplit, just rotated and named accordingly.
+
+Scans are split at the book's spine, found as the darkest or lightest band
+near the middle of each scan. If none stands out, the scan is split in the
+middle. Where each scan was split is written to the file Gutters in the
+identifier's folder, one "<percent> <scan>" per line, with scans split in the
+middle for want of a gutter marked; review them there. Gutters listed in the
+file are used as they are next time, so a split can be moved by editing its
+line and running prep again. With -c, every scan is split in the middle and
+Gutters is left alone.
+
+Renamed and overwritten files are recorded in a journal so the run can be
+reverted with "manga undo".
+
+Scans are read from the raw folder and the pages are written to the pages
+folder, leaving the scans untouched. Use -in-place to write the pages next to
+the scans (and rename them with -d) instead.`,
+	Flags:  flag.NewFlagSet("prep", flag.ExitOnError),
+	Stages: core.StageIO{In: "raw", Out: "pages"},
 }
 
 var (
 	prepD = cmdPrep.Flags.Bool("d", false, "Don't rotate and crop, just rename")
 	prepS = cmdPrep.Flags.String("s", "", "Skip splitting spreads named by `\033[4mLIST\033[m`")
+	prepI = cmdPrep.Flags.Bool("in-place", false, "Write pages into the input folder, renaming scans with -d")
+	prepC = cmdPrep.Flags.Bool("c", false, "Split scans in the middle without looking for the gutter")
 )
 
 func init() {
@@ -32,14 +54,23 @@ func init() {
 }
 
 func runPrep(cmd *Command, args []string) {
-	var ims []*Image
+	var (
+		ims []*Image
+		out string
+		j   *journal.Journal
+	)
 	if *globalX {
 		ims = imageList(args[1:], ScannerPage)
+		out = cmd.outDir("", *prepI)
+		j = cmd.journal("")
 	} else {
-		os.Chdir(core.TopLevel())
-		cmd.in(args[0], "raw")
+		core.LoadSeries()
+		cmd.in(args[0], cmd.stages().In)
 		ims = images(ScannerPage)
+		out = cmd.outDir(args[0], *prepI)
+		j = cmd.journal(args[0])
 	}
+	defer j.Close()
 
 	sort.Sort(byScannerOrder(ims))
 	// page.jpeg   (1) -> 001.jpg
@@ -49,12 +80,37 @@ func runPrep(cmd *Command, args []string) {
 		mag := int(math.Log10(float64(len(ims)))) + 1
 		for i, im := range ims {
 			newName := fmt.Sprintf("%0*d.jpg", mag, i)
-			newPath := filepath.Join(filepath.Dir(im.Path), newName)
-			os.Rename(im.Path, newPath)
+			newPath := filepath.Join(out, newName)
+			if *globalDryRun {
+				plan("%s → %s", im.Path, newPath)
+				continue
+			}
+			var err error
+			if *prepI {
+				err = j.Rename(im.Path, newPath)
+			} else if err = j.Write(newPath); err == nil {
+				err = util.CopyFile(newPath, im.Path)
+			}
+			if err != nil {
+				cmd.Fatal(err)
+			}
 		}
 	} else {
 		mag := int(math.Log10(float64(len(ims)*2))) + 1
 
+		gutterPath := core.GutterFile
+		if !*globalX {
+			gutterPath = util.Rooted(args[0], core.GutterFile)
+		}
+		gutters := make(map[string]*core.Gutter)
+		if !*prepC {
+			var err error
+			if gutters, err = core.LoadGutters(gutterPath); err != nil {
+				cmd.Fatal(err)
+			}
+		}
+		var mu sync.Mutex
+
 		imgdo("Prepping", ims, func(im *Image) {
 			ord := im.scannerOrd()
 			var first, second string
@@ -71,23 +127,111 @@ func runPrep(cmd *Command, args []string) {
 				first = fmt.Sprintf("%0*d.jpg", mag, n)
 				second = fmt.Sprintf("%0*d.jpg", mag, n+1)
 			}
+			first = filepath.Join(out, first)
+			second = filepath.Join(out, second)
+			for _, name := range []string{first, second} {
+				if err := j.Write(name); err != nil {
+					cmd.Fatal(err)
+				}
+			}
+
+			mu.Lock()
+			given := gutters[im.base()]
+			mu.Unlock()
+			g, w, h, err := scanGutter(im, given)
+			if err != nil {
+				cmd.Fatalf("%s: %v", im.base(), err)
+			}
+			mu.Lock()
+			gutters[im.base()] = g
+			mu.Unlock()
+
+			x := int(g.Percent/100*float64(w) + 0.5)
 			im.convert(
-				// Do the cropping
-				"-rotate", "-90", "-crop", "50%x100%",
-				// save both halves into the temp register, deleting the second
-				// one first (right side, first page in book order)
-				"-write", "mpr:temp", "+delete",
-				// write the one left in mpr:temp, the second page, then clear
-				// the sequence
+				// keep the rotated scan in a register
+				"-rotate", "-90", "+repage", "-write", "mpr:scan",
+				// crop the left side, the second page in book order, and
+				// write it, then clear the sequence
+				"-crop", fmt.Sprintf("%dx%d+0+0", x, h), "+repage",
 				"-write", second, "+delete",
-				// load the sequence again, reverse it, and repeat the same
-				// thing, so now the first page is the only one left
-				"mpr:temp", "+swap", "+delete", first)
+				// load the scan again and crop the right side, the first page
+				"mpr:scan", "-crop", fmt.Sprintf("%dx%d+%d+0", w-x, h, x), "+repage",
+				first)
 		})
+
+		if !*prepC {
+			saveGutters(cmd, gutterPath, ims, gutters, j)
+		}
 	}
 
 }
 
+// scanGutter returns where to split the scan im, and its width and height
+// after rotating: as given, in the middle with -c, or where the spine is
+// found, falling back to the middle.
+func scanGutter(im *Image, given *core.Gutter) (g *core.Gutter, w, h int, err error) {
+	f := im.open()
+	defer f.Close()
+
+	if given != nil || *prepC {
+		cfg, _, err := image.DecodeConfig(f)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if given == nil {
+			given = &core.Gutter{Percent: 50, Scan: im.base()}
+		}
+		return given, cfg.Height, cfg.Width, nil
+	}
+
+	m, _, err := image.Decode(f)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	g = &core.Gutter{Scan: im.base()}
+	var ok bool
+	if g.Percent, ok = findGutter(m); !ok {
+		g.Note = core.GutterNotFound
+	}
+	b := m.Bounds()
+	return g, b.Dy(), b.Dx(), nil
+}
+
+// saveGutters records where the scans were split in the file at path, in the
+// order of ims, keeping the lines for scans that weren't prepped this time.
+func saveGutters(cmd *Command, path string, ims []*Image, gutters map[string]*core.Gutter, j *journal.Journal) {
+	list := make([]*core.Gutter, 0, len(gutters))
+	notFound := 0
+	for _, im := range ims {
+		g := gutters[im.base()]
+		if g.Note == core.GutterNotFound {
+			notFound++
+		}
+		list = append(list, g)
+		delete(gutters, im.base())
+	}
+	rest := make([]*core.Gutter, 0, len(gutters))
+	for _, g := range gutters {
+		rest = append(rest, g)
+	}
+	sort.Slice(rest, func(i, j int) bool { return rest[i].Scan < rest[j].Scan })
+	list = append(list, rest...)
+
+	if notFound > 0 {
+		cmd.Printf("no gutter found in %d scan%s; check them in %s", notFound, util.Plural(notFound), path)
+	}
+	if *globalDryRun {
+		plan("write %s", path)
+		return
+	}
+	if err := j.Write(path); err != nil {
+		cmd.Fatal(err)
+	}
+	if err := core.SaveGutters(path, list); err != nil {
+		cmd.Fatal(err)
+	}
+}
+
 type byScannerOrder []*Image
 
 func (s byScannerOrder) Len() int { return len(s) }
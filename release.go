@@ -0,0 +1,435 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"ktkr.us/pkg/dn2/manga"
+
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/dn"
+	"ktkr.us/pkg/manga/util"
+)
+
+var cmdRelease = &Command{
+	Name:    "release",
+	Summary: "list | sync | <action> [options] <identifier>",
+	Help: `
+Manage releases already posted to displaynone. Releases are found by the id
+that "manga up" recorded for the identifier.
+
+Actions:
+  list     Compare the releases on the server with the local identifiers and
+           archives, reporting missing uploads, archives that changed since
+           they were uploaded, releases with no local source and manifests
+           that don't match the server. Nothing is changed.
+  sync     The same as list, but record the releases on the server in the
+           local manifests that don't match them.
+  edit     Edit the release notes, starting from the ones on the server, and
+           optionally change the ISBN and NSFW flag or upload the archive and
+           cover again.
+  publish  Publish a draft or scheduled release now, and notify the webhooks.
+  delete   Delete the release after confirmation.`,
+	Flags: flag.NewFlagSet("release", flag.ExitOnError),
+}
+
+var (
+	releaseM       = cmdRelease.Flags.String("m", "", "Release message (edit)")
+	releaseF       = cmdRelease.Flags.String("F", "", "Read the release message from `\033[4mFILE\033[m` (edit)")
+	releaseISBN    = cmdRelease.Flags.String("isbn", "", "Change the ISBN (edit)")
+	releaseNSFW    = cmdRelease.Flags.Bool("nsfw", false, "Change the NSFW flag (edit)")
+	releaseArchive = cmdRelease.Flags.Bool("archive", false, "Upload the archive again (edit)")
+	releaseCover   = cmdRelease.Flags.Bool("cover", false, "Upload the cover and thumbnail again (edit)")
+	releaseResume  = cmdRelease.Flags.Bool("resume", false, "Start from the release notes saved when posting failed (edit)")
+)
+
+var releaseActions map[string]func(cmd *Command, args []string)
+
+func init() {
+	cmdRelease.Run = runRelease
+	releaseActions = map[string]func(cmd *Command, args []string){
+		"list":    releaseList,
+		"sync":    releaseSync,
+		"edit":    releaseEdit,
+		"publish": releasePublish,
+		"delete":  releaseDelete,
+	}
+}
+
+func runRelease(cmd *Command, args []string) {
+	if len(args) == 0 {
+		help(cmd)
+	}
+
+	action, ok := releaseActions[args[0]]
+	if !ok {
+		cmd.Printf("no such action: %s", args[0])
+		help(cmd)
+	}
+
+	// allow flags after the action too
+	cmd.Flags.Parse(args[1:])
+	core.LoadConfig()
+	action(cmd, cmd.Flags.Args())
+}
+
+// recordedRelease returns the manifest of the release posted for the
+// identifier in args.
+func recordedRelease(cmd *Command, args []string) (core.Identifier, *core.Manifest) {
+	if len(args) == 0 {
+		help(cmd)
+	}
+	id := cmd.identifier(args[0])
+
+	m, err := core.LoadManifest(id)
+	if err != nil {
+		cmd.Fatal(err)
+	}
+	if m.Id == 0 {
+		cmd.Fatalf("no release recorded for %v (post it with manga up first)", id)
+	}
+	return id, m
+}
+
+func releaseList(cmd *Command, args []string) {
+	compareReleases(cmd, false)
+}
+
+func releaseSync(cmd *Command, args []string) {
+	compareReleases(cmd, true)
+}
+
+// compareReleases lists the releases on the server next to the local
+// identifiers and archives. With sync, the local manifests are brought up to
+// date with the releases matched to them.
+func compareReleases(cmd *Command, sync bool) {
+	if core.Config.Id == 0 {
+		cmd.Fatal("no series id set in .manga")
+	}
+	client, err := dn.Default()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	if *globalDryRun {
+		plan("GET %s/releases?series=%d", client.BaseURL, core.Config.Id)
+		return
+	}
+
+	remote, err := client.ListReleases(core.Config.Id)
+	if err != nil {
+		cmd.Fatalln("listing releases:", err)
+	}
+	// there may be more than one release of an identifier
+	unmatched := make(map[int]*dn.Release)
+	byIdent := make(map[core.Identifier][]*dn.Release)
+	for _, r := range remote {
+		id := core.Identifier{Kind: r.Kind, Ordinal: r.Ordinal}
+		unmatched[r.Id] = r
+		byIdent[id] = append(byIdent[id], r)
+	}
+
+	ids, err := core.Identifiers()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+	local := make(map[core.Identifier]bool)
+
+	tw := tabwriter.NewWriter(os.Stdout, 8, 4, 2, ' ', 0)
+	for _, id := range ids {
+		local[id] = true
+		m, err := core.LoadManifest(id)
+		if err != nil {
+			cmd.Fatal(err)
+		}
+
+		r, status := matchRelease(m, byIdent[id], unmatched)
+		num := "-"
+		if r != nil {
+			num = fmt.Sprintf("#%d", r.Id)
+			delete(unmatched, r.Id)
+			if recordedDiffers(m, r) {
+				if sync {
+					recordRelease(cmd, id, m, r)
+					status = append(status, "manifest updated")
+				} else {
+					status = append(status, "manifest differs (manga release sync updates it)")
+				}
+			}
+		}
+		status = append(status, releaseStatus(cmd, id, m, r))
+		fmt.Fprintf(tw, "%v\t%s\t%s\n", id, num, strings.Join(status, "; "))
+	}
+
+	orphans := make([]*dn.Release, 0, len(unmatched))
+	for _, r := range unmatched {
+		orphans = append(orphans, r)
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].Id < orphans[j].Id })
+	for _, r := range orphans {
+		id := core.Identifier{Kind: r.Kind, Ordinal: r.Ordinal}
+		status := "no local source"
+		if local[id] {
+			status = "not recorded locally"
+		}
+		fmt.Fprintf(tw, "%v\t#%d\t%s\n", id, r.Id, status)
+	}
+	tw.Flush()
+}
+
+// matchRelease finds the remote release that the manifest m of an identifier
+// stands for among rs, the releases of the identifier on the server, going by
+// the release id it records. If it records none, or one that is gone, a single
+// release of the identifier not matched yet is taken for it. It returns what
+// doesn't agree along the way.
+func matchRelease(m *core.Manifest, rs []*dn.Release, unmatched map[int]*dn.Release) (*dn.Release, []string) {
+	var status []string
+	if m.Id != 0 {
+		if r, ok := unmatched[m.Id]; ok {
+			return r, nil
+		}
+		status = append(status, fmt.Sprintf("recorded release #%d not on the server", m.Id))
+	}
+
+	var free []string
+	var r *dn.Release
+	for _, c := range rs {
+		if _, ok := unmatched[c.Id]; ok {
+			free = append(free, fmt.Sprintf("#%d", c.Id))
+			r = c
+		}
+	}
+	switch len(free) {
+	case 0:
+		return nil, status
+	case 1:
+		return r, status
+	}
+	return nil, append(status, fmt.Sprintf("%d releases on the server (%s)", len(free), strings.Join(free, ", ")))
+}
+
+// recordedDiffers reports whether the manifest m records the release r other
+// than it is on the server.
+func recordedDiffers(m *core.Manifest, r *dn.Release) bool {
+	return m.Id != r.Id ||
+		m.Filename != r.Filename ||
+		m.Filesize != int64(r.Filesize) ||
+		m.Notes != r.Notes ||
+		m.Draft != r.Draft ||
+		r.PublishAt == nil && !m.PublishAt.IsZero() ||
+		r.PublishAt != nil && !m.PublishAt.Equal(*r.PublishAt)
+}
+
+// recordRelease records the remote release r in the manifest m of id.
+func recordRelease(cmd *Command, id core.Identifier, m *core.Manifest, r *dn.Release) {
+	m.Id = r.Id
+	m.Filename = r.Filename
+	m.Filesize = int64(r.Filesize)
+	m.Notes = r.Notes
+	m.Draft = r.Draft
+	m.PublishAt = time.Time{}
+	if r.PublishAt != nil {
+		m.PublishAt = *r.PublishAt
+	}
+	if err := m.Save(id); err != nil {
+		cmd.Fatal("saving release manifest: ", err)
+	}
+}
+
+// releaseStatus compares the remote release r of id (nil if there is none)
+// with the local archive and the manifest m.
+func releaseStatus(cmd *Command, id core.Identifier, m *core.Manifest, r *dn.Release) string {
+	fi, err := core.FirstArchive(id)
+	if r == nil {
+		if err != nil {
+			return "not packaged"
+		}
+		return "not uploaded"
+	}
+	if err != nil {
+		return "no local archive"
+	}
+
+	switch {
+	case fi.Name() != r.Filename:
+		return fmt.Sprintf("archive name differs (remote %q)", r.Filename)
+	case fi.Size() != int64(r.Filesize):
+		return fmt.Sprintf("size differs (local %v, remote %v)", util.Bytes(fi.Size()), util.Bytes(r.Filesize))
+	case m.Shake256 != "" && m.Id == r.Id:
+		f, err := os.Open(util.Rooted(fi.Name()))
+		if err != nil {
+			cmd.Fatal(err)
+		}
+		sum, err := dn.Shake256(f)
+		f.Close()
+		if err != nil {
+			cmd.Fatal(err)
+		}
+		if sum != m.Shake256 {
+			return "hash differs from uploaded archive"
+		}
+	}
+	return "ok"
+}
+
+func releaseEdit(cmd *Command, args []string) {
+	id, m := recordedRelease(cmd, args)
+
+	client, err := dn.Default()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	files := make(map[string]string)
+	if *releaseCover {
+		files = coverFiles(id)
+		if err = checkCovers(cmd, id); err != nil {
+			cmd.Fatal(err)
+		}
+	}
+
+	var archive os.FileInfo
+	if *releaseArchive {
+		if archive, err = core.FirstArchive(id); err != nil {
+			cmd.Fatal(err)
+		}
+	}
+
+	if *globalDryRun {
+		plan("GET %s/release/%d", client.BaseURL, m.Id)
+		if archive != nil {
+			plan("POST http://%s/upload  archive %q (%v)", core.Config.DLServ, archive.Name(), util.Bytes(archive.Size()))
+		}
+		source := notesSource(*releaseM, *releaseF)
+		if *releaseResume {
+			source = core.DraftPath(core.ReleaseDraft, id.String())
+		}
+		plan("POST %s/release/update  release #%d, notes from %s", client.BaseURL, m.Id, source)
+		for field, name := range files {
+			plan("    %s: %s", field, name)
+		}
+		return
+	}
+
+	r, err := client.Release(m.Id)
+	if err != nil {
+		cmd.Fatalln("getting release:", err)
+	}
+
+	cmd.Flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "isbn":
+			r.ISBN = *releaseISBN
+		case "nsfw":
+			r.NSFW = *releaseNSFW
+		}
+	})
+
+	r.Notes = releaseNotes(cmd, id, *releaseM, *releaseF, r.Notes, *releaseResume)
+
+	if archive != nil {
+		cmd.Println("uploading archive to displaynone...")
+		u, err := client.Upload(util.Rooted(archive.Name()), nil)
+		if err != nil {
+			cmd.Fatalln("displaynone upload:", err)
+		}
+		r.Filename = archive.Name()
+		r.Filesize = manga.Filesize(archive.Size())
+		m.Shake256 = u.Shake256
+	}
+
+	if r, err = client.UpdateRelease(r, files); err != nil {
+		if _, serr := os.Stat(core.DraftPath(core.ReleaseDraft, id.String())); serr == nil {
+			cmd.Fatalf("updating release: %v (the notes are saved; try again with -resume)", err)
+		}
+		cmd.Fatalln("updating release:", err)
+	}
+	if err = core.RemoveDraft(core.ReleaseDraft, id.String()); err != nil {
+		cmd.Print(err)
+	}
+	cmd.Printf("updated release #\033[1m%d\033[0m (%s %v).", r.Id, core.Config.Title, id)
+
+	m.Filename = r.Filename
+	m.Filesize = int64(r.Filesize)
+	m.Notes = r.Notes
+	if err = m.Save(id); err != nil {
+		cmd.Fatal("saving release manifest: ", err)
+	}
+}
+
+func releasePublish(cmd *Command, args []string) {
+	id, m := recordedRelease(cmd, args)
+
+	client, err := dn.Default()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	if *globalDryRun {
+		plan("POST %s/release/publish  release #%d", client.BaseURL, m.Id)
+		releaseHooks(cmd, id, m)
+		return
+	}
+
+	if !m.Pending() {
+		cmd.Printf("release #%d isn't recorded as a draft or scheduled; publishing anyway", m.Id)
+	}
+	r, err := client.PublishRelease(m.Id)
+	if err != nil {
+		cmd.Fatalln("publishing release:", err)
+	}
+	cmd.Printf("published release #\033[1m%d\033[0m (%s %v).", m.Id, core.Config.Title, id)
+
+	// record the release as the server has it, so that sync agrees
+	m.Draft = r.Draft
+	m.PublishAt = time.Time{}
+	if r.PublishAt != nil {
+		m.PublishAt = *r.PublishAt
+	}
+	if err = m.Save(id); err != nil {
+		cmd.Fatal("saving release manifest: ", err)
+	}
+	releaseHooks(cmd, id, m)
+}
+
+func releaseDelete(cmd *Command, args []string) {
+	id, m := recordedRelease(cmd, args)
+
+	client, err := dn.Default()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	if *globalDryRun {
+		plan("POST %s/release/delete  release #%d", client.BaseURL, m.Id)
+		return
+	}
+
+	if !util.Promptf("Delete release #%d (%s %v)?", m.Id, core.Config.Title, id) {
+		cmd.Fatal("abort")
+	}
+
+	if err = client.DeleteRelease(m.Id); err != nil {
+		cmd.Fatalln("deleting release:", err)
+	}
+	if err = core.RemoveManifest(id); err != nil {
+		cmd.Fatal(err)
+	}
+	cmd.Printf("deleted release #%d (%s %v).", m.Id, core.Config.Title, id)
+}
+
+// notesSource describes where releaseNotes will get the notes from.
+func notesSource(m, f string) string {
+	switch {
+	case m != "":
+		return "-m"
+	case f != "":
+		return f
+	}
+	return "$EDITOR"
+}
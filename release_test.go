@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"ktkr.us/pkg/dn2/manga"
+
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/dn"
+)
+
+func TestRecordedDiffers(t *testing.T) {
+	at := time.Date(2030, 1, 2, 15, 4, 0, 0, time.UTC)
+	remote := func(draft bool, publishAt *time.Time) *dn.Release {
+		return &dn.Release{Release: manga.Release{Id: 4, Filename: "a.zip", Filesize: 10, Notes: "notes"}, Draft: draft, PublishAt: publishAt}
+	}
+	local := func(draft bool, publishAt time.Time) *core.Manifest {
+		return &core.Manifest{Id: 4, Filename: "a.zip", Filesize: 10, Notes: "notes", Draft: draft, PublishAt: publishAt}
+	}
+
+	tests := []struct {
+		name string
+		m    *core.Manifest
+		r    *dn.Release
+		want bool
+	}{
+		{"same", local(false, time.Time{}), remote(false, nil), false},
+		{"same schedule", local(false, at), remote(false, &at), false},
+		{"draft published", local(true, time.Time{}), remote(false, nil), true},
+		{"rescheduled", local(false, at), remote(false, &time.Time{}), true},
+		{"schedule dropped", local(false, at), remote(false, nil), true},
+		{"scheduled on the server", local(false, time.Time{}), remote(false, &at), true},
+	}
+	for _, tt := range tests {
+		if got := recordedDiffers(tt.m, tt.r); got != tt.want {
+			t.Errorf("%s: recordedDiffers = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -4,24 +4,39 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/journal"
 	"ktkr.us/pkg/manga/util"
 )
 
 var cmdResize = &Command{
 	Name:    "resize",
-	Summary: "[-n] [-h <height>] [ -x <images...> | <identifier> ]",
+	Summary: "[-n] [-in-place] [-h <height>] [ -x <images...> | <identifier> ]",
 	Help: `
 Resize and crop images to fit the smallest width and height among them for
 consistency. Pages are cropped from the gutter side (right for odd, left for
 even). Skips files with dashes in them (spreads).
 
+Pages much wider than most of the others are taken for spreads too, whatever
+their names, and images named as spreads that are shaped like pages are
+reported. With -rename-spreads, the resized copies of pages found to be
+spreads are named after the convention, such as 045.png to 045-046.png; the
+pages themselves are only renamed with -in-place, once the resize is agreed
+to.
+
 The resizing via ImageMagick takes into account the issues[1] caused by
 improper value vs. luminance interpretation when resizing.
 
+Images are read from the pages folder and written to the out folder, so
+resizing can be redone with different parameters. Use -in-place to overwrite the
+originals instead. Overwritten files are kept in a journal so the run can be
+reverted with "manga undo".
+
 [1] http://www.4p8.com/eric.brasseur/gamma.html`,
-	Flags: flag.NewFlagSet("resize", flag.ExitOnError),
+	Flags:  flag.NewFlagSet("resize", flag.ExitOnError),
+	Stages: core.StageIO{In: "pages", Out: "out"},
 }
 
 var (
@@ -32,6 +47,8 @@ var (
 	resizeN      = cmdResize.Flags.Bool("n", false, "Don't do colorspace correction")
 	resizeFilter = cmdResize.Flags.String("filter", "Mitchell", "Resampling filter")
 	resizeO      = cmdResize.Flags.Bool("O", false, "Don't optimize images")
+	resizeI      = cmdResize.Flags.Bool("in-place", false, "Overwrite the input images")
+	resizeRename = cmdResize.Flags.Bool("rename-spreads", false, "Rename pages shaped like spreads after the spread convention")
 )
 
 func init() {
@@ -44,7 +61,9 @@ func runResize(cmd *Command, args []string) {
 		for i, arg := range args {
 			ims[i] = namedImage(arg)
 		}
-		resize(ims)
+		j := cmd.journal("")
+		defer j.Close()
+		resize(ims, cmd.outDir("", *resizeI), j)
 		return
 	}
 
@@ -54,16 +73,22 @@ func runResize(cmd *Command, args []string) {
 		help(cmd)
 	}
 
-	cmd.in(args[0], "res")
-	resize(images(Page, Spread))
+	ims := cmd.inImages(args[0], Page, Spread)
+	out := cmd.outDir(args[0], *resizeI)
+	j := cmd.journal(args[0])
+	defer j.Close()
+	resize(ims, out, j)
 }
 
-func resize(ims []*Image) {
+// resize writes the resized images into the folder out, recording the files
+// it writes in j.
+func resize(ims []*Image, out string, j *journal.Journal) {
 	// arbitrary, seems like that's when a delay would be noticeable
 	if len(ims) > 20 {
 		fmt.Println("Analyzing images...")
 	}
 	imageSizes(ims)
+	spreads := detectSpreads(cmdResize, ims)
 
 	scaled := make([]Rect, len(ims))
 	targetWidth := 0
@@ -103,15 +128,49 @@ func resize(ims []*Image) {
 			}
 		}
 
-		if maxLoss > 0 {
+		if maxLoss > 0 && *globalDryRun {
+			plan("max pixel loss from the sides: %dpx (from %v)", maxLoss, ims[ii].base())
+		} else if maxLoss > 0 {
 			if !util.Promptf("Max pixel loss from the sides will be %dpx (from %v). Continue?", maxLoss, ims[ii].base()) {
 				cmdResize.Fatal("abort")
 			}
 		}
 	}
 
+	// the input pages are only renamed when they're overwritten anyway;
+	// otherwise the spread name goes to the resized copy
+	names := make(map[*Image]string)
+	if *resizeRename {
+		for _, im := range spreads {
+			if filepath.Join(out, im.base()) == im.Path {
+				renameSpread(cmdResize, im, j)
+			} else if name, ok := spreadName(cmdResize, im); ok {
+				names[im] = name
+			}
+		}
+	}
+
 	imgdo("Resizing", ims, func(im *Image) {
+		name, ok := names[im]
+		if !ok {
+			name = im.base()
+		}
+		dst := &Image{Path: filepath.Join(out, name), Kind: im.Kind}
+		if im.H <= *resizeH && dst.Path == im.Path {
+			return
+		}
+		if err := j.Write(dst.Path); err != nil {
+			cmdResize.Fatal(err)
+		}
+
 		if im.H <= *resizeH {
+			if *globalDryRun {
+				plan("copy %s → %s", im.Path, dst.Path)
+				return
+			}
+			if err := util.CopyFile(dst.Path, im.Path); err != nil {
+				cmdResize.Fatal(err)
+			}
 			return
 		}
 
@@ -161,11 +220,11 @@ func resize(ims []*Image) {
 			}
 		}
 
-		args = append(args, im.Path)
+		args = append(args, dst.Path)
 
 		im.convert(args...)
 		if !*resizeO {
-			im.optimize()
+			dst.optimize()
 		}
 	})
 
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ktkr.us/pkg/manga/journal"
+)
+
+// spreadRatio is how many times the median width to height ratio of the
+// images an image's ratio has to be to take it for a spread.
+const spreadRatio = 1.5
+
+// detectSpreads compares the shape of each image, whose size must be known,
+// with the median shape of ims. Pages much wider than the median are taken
+// for spreads whatever their names say, and are returned so they can be
+// renamed after the 045-046 convention. Images named as spreads that are
+// shaped like pages are reported. It needs a few images to go by.
+func detectSpreads(cmd *Command, ims []*Image) []*Image {
+	if len(ims) < 3 {
+		return nil
+	}
+
+	ratios := make([]float64, 0, len(ims))
+	for _, im := range ims {
+		if im.H > 0 {
+			ratios = append(ratios, float64(im.W)/float64(im.H))
+		}
+	}
+	if len(ratios) == 0 {
+		return nil
+	}
+	sort.Float64s(ratios)
+	median := ratios[len(ratios)/2]
+
+	var found []*Image
+	for _, im := range ims {
+		if im.H == 0 {
+			continue
+		}
+		im.Wide = float64(im.W)/float64(im.H) > median*spreadRatio
+		named := im.Kind == Spread && strings.Contains(im.name(), "-")
+
+		switch {
+		case im.Wide && im.Kind == Page:
+			cmd.Printf("%s is shaped like a spread (%d×%dpx); treating it as one", im.base(), im.W, im.H)
+			im.Kind = Spread
+			found = append(found, im)
+		case !im.Wide && named:
+			cmd.Printf("%s is named like a spread but shaped like a page (%d×%dpx)", im.base(), im.W, im.H)
+		}
+	}
+	return found
+}
+
+// spreadName gives the name the page im, such as 045.png, has as the spread
+// it is, 045-046.png. It reports why and returns false if the page can't be
+// renamed.
+func spreadName(cmd *Command, im *Image) (string, bool) {
+	name := im.name()
+	n, err := strconv.Atoi(name)
+	if err != nil {
+		cmd.Printf("can't rename %s to a spread (not a plain page number)", im.base())
+		return "", false
+	}
+	spread := fmt.Sprintf("%0*d-%0*d%s", len(name), n, len(name), n+1, im.ext())
+	dir := filepath.Dir(im.Path)
+
+	if _, err := os.Stat(filepath.Join(dir, spread)); err == nil {
+		cmd.Printf("can't rename %s to %s (already exists)", im.base(), spread)
+		return "", false
+	}
+	next := fmt.Sprintf("%0*d%s", len(name), n+1, im.ext())
+	if _, err := os.Stat(filepath.Join(dir, next)); err == nil {
+		cmd.Printf("%s exists too; check the page numbers after %s", next, spread)
+	}
+	return spread, true
+}
+
+// renameSpread renames the page im to the spread it is, recording the rename
+// in j.
+func renameSpread(cmd *Command, im *Image, j *journal.Journal) {
+	spread, ok := spreadName(cmd, im)
+	if !ok {
+		return
+	}
+	newPath := filepath.Join(filepath.Dir(im.Path), spread)
+
+	if *globalDryRun {
+		plan("%s → %s", im.Path, newPath)
+	} else if err := j.Rename(im.Path, newPath); err != nil {
+		cmd.Fatal(err)
+	}
+	im.Path = newPath
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/util"
+)
+
+var cmdStatus = &Command{
+	Name:    "status",
+	Summary: "",
+	Help: `
+Show the release state of every identifier in the series. Drafts and releases
+scheduled for later are listed as pending.`,
+}
+
+func init() {
+	cmdStatus.Run = runStatus
+}
+
+func runStatus(cmd *Command, args []string) {
+	core.LoadConfig()
+
+	ids, err := core.Identifiers()
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 8, 4, 2, ' ', 0)
+	pending := 0
+	for _, id := range ids {
+		m, err := core.LoadManifest(id)
+		if err != nil {
+			cmd.Fatal(err)
+		}
+
+		var state string
+		switch {
+		case m.Id == 0:
+			fmt.Fprintf(tw, "%v\t-\tnot released\n", id)
+			continue
+		case m.Draft:
+			state = "\033[1mpending\033[0m: draft"
+			pending++
+		case m.PublishAt.After(time.Now()):
+			state = "\033[1mpending\033[0m: scheduled for " + m.PublishAt.Local().Format("2006-01-02 15:04")
+			pending++
+		default:
+			date := m.Uploaded
+			if !m.PublishAt.IsZero() {
+				date = m.PublishAt
+			}
+			state = "released " + date.Local().Format("2006-01-02")
+		}
+		fmt.Fprintf(tw, "%v\t#%d\t%s\n", id, m.Id, state)
+	}
+	tw.Flush()
+
+	if pending > 0 {
+		fmt.Printf("\n%d pending release%s (publish with manga release publish <identifier>)\n", pending, util.Plural(pending))
+	}
+}
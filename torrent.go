@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/torrent"
+	"ktkr.us/pkg/manga/util"
+)
+
+var cmdTorrent = &Command{
+	Name:    "torrent",
+	Summary: "[-hybrid] [-piece <size>] [-o <file>] <identifier | range>",
+	Help: `
+Make a .torrent of the packaged archive of an identifier, or of every archive
+in a range such as v01-v05, and print its magnet link. The torrent is written
+to the top level of the series, named after the archive or, for a range,
+"<Title> <range> [<Group>]".
+
+Trackers and web seeds are set in .manga:
+
+    "Torrent": {
+        "Announce": ["udp://tracker.example.com:1337/announce"],
+        "WebSeeds": ["http://dl.example.com/"]
+    }
+
+Without WebSeeds, a torrent of a single archive uses the download server as a
+web seed. The piece size is chosen from the total size unless given with
+-piece. With -hybrid, BitTorrent v2 metadata is added alongside v1.`,
+	Flags: flag.NewFlagSet("torrent", flag.ExitOnError),
+}
+
+var (
+	torrentHybrid = cmdTorrent.Flags.Bool("hybrid", false, "Make a hybrid v1/v2 torrent")
+	torrentPiece  = cmdTorrent.Flags.Int("piece", 0, "Piece size in `\033[4mKiB\033[m` (a power of two)")
+	torrentO      = cmdTorrent.Flags.String("o", "", "Write the torrent to `\033[4mFILE\033[m`")
+)
+
+func init() {
+	cmdTorrent.Run = runTorrent
+}
+
+func runTorrent(cmd *Command, args []string) {
+	if len(args) == 0 {
+		help(cmd)
+	}
+
+	core.LoadConfig()
+	ids, err := core.ParseRange(args[0])
+	if err != nil {
+		cmd.Fatal(err)
+	}
+
+	var files []torrent.File
+	for _, id := range ids {
+		fi, err := core.FirstArchive(id)
+		if err != nil {
+			if len(ids) == 1 {
+				cmd.Fatal(err)
+			}
+			cmd.Printf("skipping %v: %v", id, err)
+			continue
+		}
+		files = append(files, torrent.File{Path: util.Rooted(fi.Name()), Name: fi.Name()})
+	}
+	if len(files) == 0 {
+		cmd.Fatalf("no archives in %s", args[0])
+	}
+
+	out := *torrentO
+	if out == "" {
+		name := releaseName(args[0], nil)
+		if len(files) == 1 {
+			name = strings.TrimSuffix(files[0].Name, filepath.Ext(files[0].Name))
+		}
+		out = util.Rooted(name + ".torrent")
+	}
+
+	writeTorrent(cmd, releaseName(args[0], nil), files, out, true)
+}
+
+// writeTorrent makes a torrent named name of files, writes it to out and
+// prints its magnet link. Web seeds are only added if seeded is set, as
+// files that were never uploaded have none.
+func writeTorrent(cmd *Command, name string, files []torrent.File, out string, seeded bool) {
+	opt := torrent.Options{
+		Name:        name,
+		PieceLength: int64(*torrentPiece) * int64(util.KiB),
+		Hybrid:      *torrentHybrid,
+		CreatedBy:   "manga",
+	}
+	if tc := core.Config.Torrent; tc != nil {
+		opt.Announce = tc.Announce
+		opt.WebSeeds = tc.WebSeeds
+	}
+	if len(opt.WebSeeds) == 0 && len(files) == 1 && core.Config.DLServ != "" {
+		opt.WebSeeds = []string{core.DownloadURL(files[0].Name)}
+	}
+	if !seeded {
+		opt.WebSeeds = nil
+	}
+	if len(opt.Announce) == 0 {
+		cmd.Print("no trackers set in .manga; the torrent will rely on DHT and web seeds")
+	}
+
+	var total util.Bytes
+	for _, f := range files {
+		if fi, err := os.Stat(f.Path); err == nil {
+			total += util.Bytes(fi.Size())
+		}
+	}
+
+	if *globalDryRun {
+		pl := opt.PieceLength
+		if pl == 0 {
+			pl = torrent.PieceLength(int64(total))
+		}
+		plan("hash %d file%s (%v) in %v pieces", len(files), util.Plural(len(files)), total, util.Bytes(pl))
+		for _, f := range files {
+			plan("    %s", f.Name)
+		}
+		plan("write %s", out)
+		return
+	}
+
+	cmd.Printf("hashing %d file%s (%v)...", len(files), util.Plural(len(files)), total)
+	t, err := torrent.Make(files, opt)
+	if err != nil {
+		cmd.Fatal(err)
+	}
+	if err = ioutil.WriteFile(out, t.Meta, 0644); err != nil {
+		cmd.Fatal(err)
+	}
+
+	cmd.Printf("wrote %s", out)
+	fmt.Println(t.Magnet())
+}
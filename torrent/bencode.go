@@ -0,0 +1,57 @@
+package torrent
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// dict is a bencoded dictionary. Its keys are written in sorted order, as the
+// format requires.
+type dict map[string]interface{}
+
+// bencode encodes v, which may be a dict, a list ([]interface{}), a string,
+// a byte slice or an integer.
+func bencode(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case dict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('d')
+		for _, k := range keys {
+			bencode(buf, k)
+			if err := bencode(buf, v[k]); err != nil {
+				return fmt.Errorf("%s: %v", k, err)
+			}
+		}
+		buf.WriteByte('e')
+	case []interface{}:
+		buf.WriteByte('l')
+		for _, x := range v {
+			if err := bencode(buf, x); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	case string:
+		buf.WriteString(strconv.Itoa(len(v)))
+		buf.WriteByte(':')
+		buf.WriteString(v)
+	case []byte:
+		buf.WriteString(strconv.Itoa(len(v)))
+		buf.WriteByte(':')
+		buf.Write(v)
+	case int:
+		fmt.Fprintf(buf, "i%de", v)
+	case int64:
+		fmt.Fprintf(buf, "i%de", v)
+	default:
+		return fmt.Errorf("can't bencode %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+// Package torrent makes BitTorrent metainfo files for releases: v1 torrents,
+// and hybrid v1/v2 torrents that clients of either version can use.
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	blockSize = 16 << 10 // v2 merkle tree leaf size
+
+	minPieceLength = 32 << 10
+	maxPieceLength = 16 << 20
+	targetPieces   = 1500
+)
+
+// File is a file to put in a torrent.
+type File struct {
+	Path string // on disk
+	Name string // in the torrent
+}
+
+// Options describe the torrent to make.
+type Options struct {
+	Name        string // of the torrent, and of its directory if it has more than one file
+	PieceLength int64  // chosen from the total size if zero
+	Announce    []string
+	WebSeeds    []string
+	Hybrid      bool // add v2 metadata
+	CreatedBy   string
+	Comment     string
+}
+
+// Torrent is a finished torrent.
+type Torrent struct {
+	Name       string
+	Meta       []byte // the .torrent file
+	InfoHash   [sha1.Size]byte
+	InfoHashV2 []byte // SHA-256 of the info dictionary, for hybrid torrents
+	Announce   []string
+	WebSeeds   []string
+}
+
+// PieceLength picks a power of two piece length that splits total bytes into
+// a reasonable number of pieces.
+func PieceLength(total int64) int64 {
+	pl := int64(minPieceLength)
+	for pl < maxPieceLength && total/pl > targetPieces {
+		pl *= 2
+	}
+	return pl
+}
+
+// Make hashes files and builds a torrent of them. A single file makes a
+// single-file torrent, named after the file.
+func Make(files []File, opt Options) (*Torrent, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files")
+	}
+	files = append([]File(nil), files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	sizes := make([]int64, len(files))
+	var total int64
+	for i, f := range files {
+		fi, err := os.Stat(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = fi.Size()
+		total += fi.Size()
+	}
+
+	pl := opt.PieceLength
+	if pl == 0 {
+		pl = PieceLength(total)
+	}
+	if pl < blockSize || pl&(pl-1) != 0 {
+		return nil, fmt.Errorf("piece length %d isn't a power of two of at least %d", pl, blockSize)
+	}
+
+	single := len(files) == 1
+	name := opt.Name
+	if single {
+		name = files[0].Name
+	}
+
+	v1 := newPieceHasher(pl)
+	var (
+		v1Files     []interface{}
+		fileTree    = make(dict)
+		pieceLayers = make(dict)
+	)
+	for i, f := range files {
+		var v2 *blockHasher
+		w := io.Writer(v1)
+		if opt.Hybrid {
+			v2 = new(blockHasher)
+			w = io.MultiWriter(v1, v2)
+		}
+		if err := copyFile(w, f.Path); err != nil {
+			return nil, err
+		}
+		v1Files = append(v1Files, dict{"length": sizes[i], "path": []interface{}{f.Name}})
+
+		if !opt.Hybrid {
+			continue
+		}
+		entry := dict{"length": sizes[i]}
+		if sizes[i] > 0 {
+			root, layer := merkle(v2.finish(), pl)
+			entry["pieces root"] = root
+			if sizes[i] > pl {
+				pieceLayers[string(root)] = layer
+			}
+		}
+		fileTree[f.Name] = dict{"": entry}
+
+		// in hybrid torrents, every file starts on a piece boundary
+		if i == len(files)-1 {
+			continue
+		}
+		if pad := v1.pad(); pad > 0 {
+			v1Files = append(v1Files, dict{
+				"attr":   "p",
+				"length": pad,
+				"path":   []interface{}{".pad", fmt.Sprint(pad)},
+			})
+		}
+	}
+
+	info := dict{
+		"name":         name,
+		"piece length": pl,
+		"pieces":       v1.finish(),
+	}
+	if single {
+		info["length"] = sizes[0]
+	} else {
+		info["files"] = v1Files
+	}
+	if opt.Hybrid {
+		info["meta version"] = 2
+		info["file tree"] = fileTree
+	}
+
+	t := &Torrent{Name: name, Announce: opt.Announce, WebSeeds: opt.WebSeeds}
+	buf := new(bytes.Buffer)
+	if err := bencode(buf, info); err != nil {
+		return nil, err
+	}
+	t.InfoHash = sha1.Sum(buf.Bytes())
+	if opt.Hybrid {
+		sum := sha256.Sum256(buf.Bytes())
+		t.InfoHashV2 = sum[:]
+	}
+
+	meta := dict{
+		"info":          info,
+		"creation date": time.Now().Unix(),
+	}
+	if len(opt.Announce) > 0 {
+		meta["announce"] = opt.Announce[0]
+		tiers := make([]interface{}, len(opt.Announce))
+		for i, a := range opt.Announce {
+			tiers[i] = []interface{}{a}
+		}
+		meta["announce-list"] = tiers
+	}
+	if len(opt.WebSeeds) > 0 {
+		seeds := make([]interface{}, len(opt.WebSeeds))
+		for i, s := range opt.WebSeeds {
+			seeds[i] = s
+		}
+		meta["url-list"] = seeds
+	}
+	if opt.Hybrid && len(pieceLayers) > 0 {
+		meta["piece layers"] = pieceLayers
+	}
+	if opt.CreatedBy != "" {
+		meta["created by"] = opt.CreatedBy
+	}
+	if opt.Comment != "" {
+		meta["comment"] = opt.Comment
+	}
+
+	buf = new(bytes.Buffer)
+	if err := bencode(buf, meta); err != nil {
+		return nil, err
+	}
+	t.Meta = buf.Bytes()
+	return t, nil
+}
+
+// Magnet returns a magnet link for the torrent.
+func (t *Torrent) Magnet() string {
+	q := "xt=urn:btih:" + hex.EncodeToString(t.InfoHash[:])
+	if t.InfoHashV2 != nil {
+		// multihash: sha2-256 (0x12), 32 bytes (0x20)
+		q += "&xt=urn:btmh:1220" + hex.EncodeToString(t.InfoHashV2)
+	}
+	q += "&dn=" + url.QueryEscape(t.Name)
+	for _, a := range t.Announce {
+		q += "&tr=" + url.QueryEscape(a)
+	}
+	for _, s := range t.WebSeeds {
+		q += "&ws=" + url.QueryEscape(s)
+	}
+	return "magnet:?" + q
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// pieceHasher computes the SHA-1 piece hashes of v1 torrents.
+type pieceHasher struct {
+	length int64
+	n      int64 // bytes in the current piece
+	h      hash.Hash
+	pieces []byte
+}
+
+func newPieceHasher(length int64) *pieceHasher {
+	return &pieceHasher{length: length, h: sha1.New()}
+}
+
+func (p *pieceHasher) Write(b []byte) (int, error) {
+	written := len(b)
+	for len(b) > 0 {
+		k := p.length - p.n
+		if int64(len(b)) < k {
+			k = int64(len(b))
+		}
+		p.h.Write(b[:k])
+		p.n += k
+		b = b[k:]
+		if p.n == p.length {
+			p.pieces = p.h.Sum(p.pieces)
+			p.h.Reset()
+			p.n = 0
+		}
+	}
+	return written, nil
+}
+
+// pad fills the current piece with zeros and returns how many were added.
+func (p *pieceHasher) pad() int64 {
+	if p.n == 0 {
+		return 0
+	}
+	pad := p.length - p.n
+	p.Write(make([]byte, pad))
+	return pad
+}
+
+func (p *pieceHasher) finish() []byte {
+	if p.n > 0 {
+		p.pieces = p.h.Sum(p.pieces)
+		p.h.Reset()
+		p.n = 0
+	}
+	return p.pieces
+}
+
+// blockHasher computes the SHA-256 hashes of a file's 16 KiB blocks, the
+// leaves of its v2 merkle tree.
+type blockHasher struct {
+	buf    []byte
+	leaves [][]byte
+}
+
+func (b *blockHasher) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		k := blockSize - len(b.buf)
+		if len(p) < k {
+			k = len(p)
+		}
+		b.buf = append(b.buf, p[:k]...)
+		p = p[k:]
+		if len(b.buf) == blockSize {
+			b.flush()
+		}
+	}
+	return written, nil
+}
+
+func (b *blockHasher) flush() {
+	sum := sha256.Sum256(b.buf)
+	b.leaves = append(b.leaves, sum[:])
+	b.buf = b.buf[:0]
+}
+
+func (b *blockHasher) finish() [][]byte {
+	if len(b.buf) > 0 {
+		b.flush()
+	}
+	return b.leaves
+}
+
+// merkle returns the root of the merkle tree over leaves, padded with zero
+// hashes to a power of two, and its layer of piece hashes, where each node
+// covers pieceLength bytes.
+func merkle(leaves [][]byte, pieceLength int64) (root, pieceLayer []byte) {
+	perPiece := int(pieceLength / blockSize)
+	pieces := (len(leaves) + perPiece - 1) / perPiece
+
+	n := 1
+	for n < len(leaves) {
+		n *= 2
+	}
+	layer := make([][]byte, n)
+	copy(layer, leaves)
+	for i := len(leaves); i < n; i++ {
+		layer[i] = make([]byte, sha256.Size)
+	}
+
+	for width := 1; len(layer) > 1; width *= 2 {
+		if width == perPiece {
+			for _, h := range layer[:pieces] {
+				pieceLayer = append(pieceLayer, h...)
+			}
+		}
+		next := make([][]byte, len(layer)/2)
+		for i := range next {
+			sum := sha256.Sum256(append(append([]byte(nil), layer[2*i]...), layer[2*i+1]...))
+			next[i] = sum[:]
+		}
+		layer = next
+	}
+	return layer[0], pieceLayer
+}
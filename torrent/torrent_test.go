@@ -0,0 +1,212 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestBencode(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{"spam", "4:spam"},
+		{[]byte{0, 1}, "2:\x00\x01"},
+		{42, "i42e"},
+		{int64(-3), "i-3e"},
+		{[]interface{}{"a", 1}, "l1:ai1ee"},
+		// keys are sorted as raw strings, whatever order they were added in
+		{dict{"piece length": 1, "pieces": "", "name": "x", "Z": 0, "": 2}, "d0:i2e1:Zi0e4:name1:x12:piece lengthi1e6:pieces0:e"},
+		{dict{"info": dict{"b": 1, "a": dict{"d": 1, "c": 2}}}, "d4:infod1:ad1:ci2e1:di1ee1:bi1eee"},
+	}
+	for _, tt := range tests {
+		buf := new(bytes.Buffer)
+		if err := bencode(buf, tt.v); err != nil {
+			t.Errorf("bencode(%v): %v", tt.v, err)
+			continue
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("bencode(%v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+
+	if err := bencode(new(bytes.Buffer), dict{"x": 1.5}); err == nil {
+		t.Error("bencoded a float")
+	}
+}
+
+func TestPieceLength(t *testing.T) {
+	tests := []struct {
+		total, want int64
+	}{
+		{0, 32 << 10},
+		{1, 32 << 10},
+		{targetPieces * 32 << 10, 32 << 10},
+		{(targetPieces + 1) * 32 << 10, 64 << 10},
+		{700 << 20, 512 << 10},
+		{4 << 30, 4 << 20},
+		{1 << 50, maxPieceLength},
+	}
+	for _, tt := range tests {
+		if got := PieceLength(tt.total); got != tt.want {
+			t.Errorf("PieceLength(%d) = %d, want %d", tt.total, got, tt.want)
+		}
+	}
+}
+
+// testData makes n bytes of content that differs with seed.
+func testData(n, seed int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte((i*7 + seed) % 251)
+	}
+	return b
+}
+
+type testFile struct {
+	name       string
+	size, seed int
+}
+
+// The expected hashes were computed independently of this package, following
+// BEP 3, 47 and 52.
+func TestMake(t *testing.T) {
+	single := []testFile{{"Title v01 [G].zip", 100000, 3}}
+	// out of order, with files that end mid-piece, one smaller than a piece
+	// and an empty one
+	multi := []testFile{
+		{"Title v02 [G].zip", 40000, 5},
+		{"Title v01 [G].zip", 70000, 1},
+		{"notes.txt", 10000, 9},
+		{"zero", 0, 0},
+	}
+
+	tests := []struct {
+		name     string
+		files    []testFile
+		hybrid   bool
+		infoHash string
+		v2Hash   string
+		// SHA-256 of each file's piece layer, by pieces root
+		layers map[string]string
+	}{
+		{
+			name:     "single",
+			files:    single,
+			infoHash: "013b13a801d932831f3b2d68025e932f31889620",
+		},
+		{
+			name:     "Title v01-v02 [G]",
+			files:    multi,
+			infoHash: "dc7d982e8ec6273696fe7be20f4ae7f7aeef0afb",
+		},
+		{
+			name:     "single",
+			files:    single,
+			hybrid:   true,
+			infoHash: "206b34ad2f39fae445e9b2bc9177c64bc30cafe1",
+			v2Hash:   "fc568f761b66d79b5ad8333cd79b3f3725bb1e142682748ddbef55bf0788d596",
+			layers: map[string]string{
+				"43ae2698d3c75be7703641a82c823d1b513b5e7315bfcc2e5ac089dc16476c63": "20536bd4b6a8da7e58547210a61109ffe09704d4181ced571f1d08cf2a650784",
+			},
+		},
+		{
+			name:     "Title v01-v02 [G]",
+			files:    multi,
+			hybrid:   true,
+			infoHash: "711f8e9e0417730fd4af2e9441e03bb2aaa96ad2",
+			v2Hash:   "288e26458942f4354195ab2f2de7b21e616f604d1501cf2e469192f33f02f4ec",
+			layers: map[string]string{
+				"9593fabfba76114839bc7873d857d51dbe85bb3c4127377790f48401fb8e025e": "f271e374299b7470c4bfa156167e47cedadfc6e0250caa7e19ab0edf7ad8f1c6",
+				"1c137ee951b857352bf0af3fb2ae6b7fa5d8ad33170fb1b0f0f76cc3b90f9641": "1c137ee951b857352bf0af3fb2ae6b7fa5d8ad33170fb1b0f0f76cc3b90f9641",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		var files []File
+		for _, f := range tt.files {
+			path := filepath.Join(dir, f.name)
+			if err := ioutil.WriteFile(path, testData(f.size, f.seed), 0644); err != nil {
+				t.Fatal(err)
+			}
+			files = append(files, File{Path: path, Name: f.name})
+		}
+
+		tor, err := Make(files, Options{Name: tt.name, PieceLength: 32 << 10, Hybrid: tt.hybrid})
+		if err != nil {
+			t.Errorf("%s (hybrid %v): %v", tt.name, tt.hybrid, err)
+			continue
+		}
+		if got := hex.EncodeToString(tor.InfoHash[:]); got != tt.infoHash {
+			t.Errorf("%s (hybrid %v): info hash %s, want %s", tt.name, tt.hybrid, got, tt.infoHash)
+		}
+		if got := hex.EncodeToString(tor.InfoHashV2); got != tt.v2Hash {
+			t.Errorf("%s (hybrid %v): v2 info hash %s, want %s", tt.name, tt.hybrid, got, tt.v2Hash)
+		}
+
+		// BEP 47 pad files only go into hybrid torrents
+		if hasPad := bytes.Contains(tor.Meta, []byte("4:.pad")); hasPad != (tt.hybrid && len(tt.files) > 1) {
+			t.Errorf("%s (hybrid %v): pad files present: %v", tt.name, tt.hybrid, hasPad)
+		}
+
+		layers, err := pieceLayers(tor.Meta)
+		if err != nil {
+			t.Errorf("%s (hybrid %v): %v", tt.name, tt.hybrid, err)
+			continue
+		}
+		if len(layers) != len(tt.layers) {
+			t.Errorf("%s (hybrid %v): %d piece layers, want %d", tt.name, tt.hybrid, len(layers), len(tt.layers))
+		}
+		for root, want := range tt.layers {
+			sum := sha256.Sum256(layers[root])
+			if got := hex.EncodeToString(sum[:]); got != want {
+				t.Errorf("%s (hybrid %v): piece layer of %s hashes to %s, want %s", tt.name, tt.hybrid, root, got, want)
+			}
+		}
+	}
+}
+
+// pieceLayers reads the piece layers dictionary of a torrent, by the hex of
+// each pieces root.
+func pieceLayers(meta []byte) (map[string][]byte, error) {
+	layers := make(map[string][]byte)
+	key := []byte("12:piece layersd")
+	i := bytes.Index(meta, key)
+	if i < 0 {
+		return layers, nil
+	}
+	b := meta[i+len(key):]
+
+	str := func() ([]byte, error) {
+		colon := bytes.IndexByte(b, ':')
+		if colon < 0 {
+			return nil, strconv.ErrSyntax
+		}
+		n, err := strconv.Atoi(string(b[:colon]))
+		if err != nil || colon+1+n > len(b) {
+			return nil, strconv.ErrSyntax
+		}
+		s := b[colon+1 : colon+1+n]
+		b = b[colon+1+n:]
+		return s, nil
+	}
+	for len(b) > 0 && b[0] != 'e' {
+		root, err := str()
+		if err != nil {
+			return nil, err
+		}
+		layer, err := str()
+		if err != nil {
+			return nil, err
+		}
+		layers[hex.EncodeToString(root)] = layer
+	}
+	return layers, nil
+}
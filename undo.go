@@ -0,0 +1,35 @@
+package main
+
+import (
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/journal"
+	"ktkr.us/pkg/manga/util"
+)
+
+var cmdUndo = &Command{
+	Name:    "undo",
+	Summary: "<identifier>",
+	Help: `
+Revert the last prep or resize run on an identifier. Renamed files get their
+old names back, overwritten files are restored and new files are removed.
+Runs that were interrupted can be undone as well. Repeat to go further back.`,
+}
+
+func init() {
+	cmdUndo.Run = runUndo
+}
+
+func runUndo(cmd *Command, args []string) {
+	if len(args) == 0 {
+		help(cmd)
+	}
+
+	core.LoadSeries()
+	id := cmd.identifier(args[0])
+
+	name, err := journal.Undo(util.Rooted(id.String()))
+	if err != nil {
+		cmd.Fatal(err)
+	}
+	cmd.Printf("reverted %s on %v", name, id)
+}
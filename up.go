@@ -4,12 +4,11 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"os"
-	"strconv"
-
-	"ktkr.us/pkg/dn2/manga"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"ktkr.us/pkg/manga/batoto"
 	"ktkr.us/pkg/manga/core"
@@ -20,9 +19,26 @@ import (
 
 var cmdUp = &Command{
 	Name:    "up",
-	Summary: "[-m <message>] [-isbn <ISBN>] [-nsfw] [-b] <identifier>",
+	Summary: "[-m <message> | -F <file>] [-isbn <ISBN>] [-nsfw] [-draft | -at <time>] [-d <dest,...> | -b | -retry] <identifier>",
 	Help: `
-Upload archives and update databases.`,
+Upload archives and update databases.
+
+The release is published at once to every destination in Destinations in
+.manga (displaynone if there are none), or to the ones named with -d; -b is
+short for -d batoto. The outcome for each is recorded in the release manifest,
+and -retry publishes again to only those that failed. Webhooks are notified
+once every destination has succeeded and the release is public. See the
+README for setting up form uploads, mirrors and webhooks.
+
+Release notes are edited in $EDITOR, starting from templates/release.txt if
+there is one, unless given with -m or -F. They are checked, and previewed as
+HTML when edited, before anything is posted. Edited notes are kept in
+.drafts/release until posted, and -resume starts from them again.
+
+With -draft, the release stays hidden until "manga release publish". With -at,
+the server publishes it at the given time ("2006-01-02 15:04" or RFC 3339).
+Both only work when publishing to displaynone alone, as the other destinations
+can't hold a release back.`,
 	Flags: flag.NewFlagSet("up", flag.ExitOnError),
 }
 
@@ -32,12 +48,19 @@ func init() {
 }
 
 var (
-	upM    = cmdUp.Flags.String("m", "", "Release message")
-	upISBN = cmdUp.Flags.String("isbn", "", "ISBN")
-	upNSFW = cmdUp.Flags.Bool("nsfw", false, "Mark release as NSFW")
-	upMeta = cmdUp.Flags.Bool("meta", false, "Only post metadata")
+	upM     = cmdUp.Flags.String("m", "", "Release message")
+	upF     = cmdUp.Flags.String("F", "", "Read the release message from `\033[4mFILE\033[m` (- for stdin)")
+	upISBN  = cmdUp.Flags.String("isbn", "", "ISBN")
+	upNSFW  = cmdUp.Flags.Bool("nsfw", false, "Mark release as NSFW")
+	upMeta  = cmdUp.Flags.Bool("meta", false, "Only post metadata")
+	upDraft = cmdUp.Flags.Bool("draft", false, "Create the release as an unpublished draft")
+	upAt    = cmdUp.Flags.String("at", "", "Publish the release at `\033[4mTIME\033[m`")
 
-	upB        = cmdUp.Flags.Bool("b", false, "Upload to Batoto")
+	upDest   = cmdUp.Flags.String("d", "", "Publish to the comma separated `\033[4mDESTINATIONS\033[m`")
+	upRetry  = cmdUp.Flags.Bool("retry", false, "Publish only to destinations that failed last time")
+	upResume = cmdUp.Flags.Bool("resume", false, "Start from the release notes saved when posting failed")
+
+	upB        = cmdUp.Flags.Bool("b", false, "Upload to Batoto only")
 	upBArchive = cmdUp.Flags.Bool("archive", false, "Flag Batoto chapter as archived")
 	upBTitle   = cmdUp.Flags.String("t", "", "Chapter title (for single chapters)")
 
@@ -45,143 +68,259 @@ var (
 )
 
 func doUp(cmd *Command, args []string) {
+	if len(args) == 0 {
+		help(cmd)
+	}
+
 	core.LoadConfig()
 	id := cmd.identifier(args[0])
 	if core.Config.Id == 0 {
-		cmdUp.Fatal("manga up: no series id set in .manga")
+		cmd.Fatal("no series id set in .manga")
 	}
 
-	if *upB {
-		batotoUpload(id)
-	} else {
-		displaynoneUpload(id)
+	m, err := core.LoadManifest(id)
+	if err != nil {
+		cmd.Fatal(err)
 	}
-}
 
-func displaynoneUpload(id core.Identifier) {
-	if core.Config.Remote == "" {
-		cmdUp.Fatal("displaynone remote url not set")
+	var ups []Uploader
+	for _, name := range destinations(cmd, m) {
+		// only displaynone can hold a release back; the others would have
+		// it out before it is published there
+		if (*upDraft || *upAt != "") && name != "displaynone" {
+			cmd.Fatalf("-draft and -at only work with displaynone, and %s would publish right away (publish there with -d once the release is public)", name)
+		}
+		u, _ := newUploader(name)
+		ups = append(ups, u)
+	}
+	if len(ups) == 0 {
+		cmd.Print("nothing to retry")
+		return
 	}
 
-	archiveFi, err := core.FirstArchive(id)
-	if err != nil {
-		cmdUp.Fatal("displaynone: ", err)
+	// prepare one at a time, since preparing may prompt
+	for _, u := range ups {
+		if *globalDryRun {
+			plan("# %s", u.Name())
+		}
+		if err := u.Prepare(id); err != nil {
+			cmd.Fatalf("%s: %v", u.Name(), err)
+		}
+	}
+	if *globalDryRun {
+		if !upHeld() {
+			releaseHooks(cmd, id, m)
+		}
+		return
 	}
 
-	r := &manga.Release{
-		SeriesId: core.Config.Id,
-		Kind:     id.Kind,
-		Ordinal:  id.Ordinal,
-		Filename: archiveFi.Name(),
-		Filesize: manga.Filesize(archiveFi.Size()),
-		NSFW:     *upNSFW,
-		ISBN:     *upISBN,
+	t := make(job.Group, len(ups))
+	for i, u := range ups {
+		t[i] = job.New(publishJob{u}, u.Name())
 	}
+	errs := t.Wait()
 
-	const releasemsgName = "MANGA-RELEASEMSG"
+	// the uploaders may have updated the manifest themselves
+	if m, err = core.LoadManifest(id); err != nil {
+		cmd.Fatal(err)
+	}
+	if m.Destinations == nil {
+		m.Destinations = make(map[string]*core.DestStatus)
+	}
 
-	if *upM == "" {
-		util.Launch(util.GetEditor(), releasemsgName)
-		tmpdata, err := ioutil.ReadFile(releasemsgName)
-		if err != nil {
-			if !os.IsNotExist(err) {
-				cmdUp.Fatalln("displaynone upload: error reading release notes:", err)
-			}
+	failed := 0
+	tw := tabwriter.NewWriter(os.Stdout, 8, 4, 2, ' ', 0)
+	for i, u := range ups {
+		st := &core.DestStatus{Time: time.Now()}
+		if errs[i] != nil {
+			failed++
+			st.Error = errs[i].Error()
+			fmt.Fprintf(tw, "%s\tfailed\t%s\n", u.Name(), st.Error)
 		} else {
-			*upM = string(tmpdata)
+			st.OK = true
+			st.URL = u.URL()
+			fmt.Fprintf(tw, "%s\tok\t%s\n", u.Name(), st.URL)
 		}
+		m.Destinations[u.Name()] = st
 	}
+	tw.Flush()
 
-	defer os.Remove(releasemsgName)
+	if err = m.Save(id); err != nil {
+		cmd.Fatal("saving release manifest: ", err)
+	}
+	if failed > 0 {
+		if _, err := os.Stat(core.DraftPath(core.ReleaseDraft, id.String())); err == nil {
+			cmd.Fatalf("%d of %d destinations failed (try them again with -retry -resume to keep the release notes)", failed, len(ups))
+		}
+		cmd.Fatalf("%d of %d destinations failed (try them again with -retry)", failed, len(ups))
+	}
+	if m.Pending() {
+		cmd.Print("the release isn't public yet; webhooks are notified by manga release publish")
+		return
+	}
+	releaseHooks(cmd, id, m)
+}
 
-	r.Notes = *upM
+// upHeld reports whether -draft or -at hold the release back from being
+// public once uploaded.
+func upHeld() bool {
+	if *upDraft {
+		return true
+	}
+	if *upAt == "" {
+		return false
+	}
+	t, err := parsePublishTime(*upAt)
+	return err == nil && t.After(time.Now())
+}
 
-	/*
-		files := map[string]string{
-			"archive": rooted(r.Filename),
+// releaseHooks notifies the webhooks of the release of id, linking to it on
+// displaynone, or on the first destination with a URL.
+func releaseHooks(cmd *Command, id core.Identifier, m *core.Manifest) {
+	data, err := newNotesData(&id)
+	if err != nil {
+		cmd.Print("webhooks: ", err)
+		return
+	}
+	hd := &HookData{NotesData: data, Event: "release", Text: m.Notes}
+
+	if st, ok := m.Destinations["displaynone"]; ok && st.OK {
+		hd.URL = st.URL
+	}
+	if hd.URL == "" {
+		for _, name := range uploaderNames() {
+			if st, ok := m.Destinations[name]; ok && st.OK && st.URL != "" {
+				hd.URL = st.URL
+				break
+			}
 		}
-	*/
-	files := make(map[string]string)
+	}
+	fireWebhooks(cmd, hd)
+}
 
-	if id.Kind != manga.Chapter {
-		files["cover"] = util.Rooted(fmt.Sprintf("%s-%s.jpg", core.Config.Shortname, id))
-		files["thumb"] = util.Rooted(fmt.Sprintf("%s-%s-thumb.jpg", core.Config.Shortname, id))
+// destinations returns the names of the destinations to publish to, checking
+// that they are known.
+func destinations(cmd *Command, m *core.Manifest) []string {
+	var names []string
+	switch {
+	case *upDest != "":
+		names = strings.Split(*upDest, ",")
+	case *upB:
+		names = []string{"batoto"}
+	case len(core.Config.Destinations) > 0:
+		names = core.Config.Destinations
+	default:
+		names = []string{"displaynone"}
 	}
 
-	if !(*upMeta) {
-		cmdUp.Println("uploading archive to displaynone...")
-		resp, err := dn.UploadFile(util.Rooted(r.Filename))
-		if err != nil {
-			cmdUp.Fatalln("displaynone upload:", err)
+	var dests []string
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if _, ok := newUploader(name); !ok {
+			cmd.Fatalf("unknown destination %q (known: %s)", name, strings.Join(uploaderNames(), ", "))
 		}
-		if resp.StatusCode != http.StatusCreated {
-			cmdUp.Println("displaynone upload: expected status 201, got", resp.Status)
-			var e struct{ Error string }
-			if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
-				cmdUp.Fatalln("failed decoding response:", err)
-			} else {
-				cmdUp.Fatalln("server responded:", e)
+		if *upRetry {
+			if st, ok := m.Destinations[name]; ok && st.OK {
+				continue
 			}
 		}
+		dests = append(dests, name)
 	}
-	cmdUp.Println("posting metadata...")
-	resp, err := dn.PostForm(core.Config.Remote, "/release/create", files, r)
+	return dests
+}
+
+// parsePublishTime parses a release time given on the command line, either
+// as "2006-01-02 15:04" in local time or in RFC 3339 format.
+func parsePublishTime(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
 	if err != nil {
-		cmdUp.Fatalln("displaynone upload:", err)
+		return t, fmt.Errorf("invalid time '%s' (want \"2006-01-02 15:04\" or RFC 3339)", s)
 	}
+	return t, nil
+}
 
-	defer resp.Body.Close()
-
-	fmt.Println(resp.Status)
-
-	if resp.StatusCode != http.StatusCreated {
-		var e Error
-		json.NewDecoder(resp.Body).Decode(&e)
-		cmdUp.Fatalln("displaynone upload:", e)
+// releaseNotes returns the release notes given with -m or read from the file
+// named by -F. Without either, the notes are edited in $EDITOR, starting from
+// initial, which is taken as is with -no-input. With resume, they start from
+// the notes saved for id instead. The notes are checked in any case, and edits
+// are previewed before going on.
+//
+// Edited notes are kept in the drafts of the series until they have been
+// posted, when the caller removes them with core.RemoveDraft.
+func releaseNotes(cmd *Command, id core.Identifier, m, f, initial string, resume bool) string {
+	path := core.DraftPath(core.ReleaseDraft, id.String())
+	if resume {
+		saved, err := core.LoadDraft(core.ReleaseDraft, id.String())
+		if os.IsNotExist(err) {
+			cmd.Fatalf("no release notes saved for %v", id)
+		} else if err != nil {
+			cmd.Fatalln("error reading release notes:", err)
+		}
+		initial = saved
+	} else if _, err := os.Stat(path); err == nil && m == "" && f == "" {
+		cmd.Fatalf("release notes for %v from an earlier attempt are saved in %s (continue with them with -resume, or remove the file)", id, path)
 	}
 
-	json.NewDecoder(resp.Body).Decode(r)
-	cmdUp.Printf("created release #\033[1m%d\033[0m (%s %v).", r.Id, core.Config.Title, id)
-}
-
-func batotoUpload(id core.Identifier) {
-	var chaps []*core.ChapSplit
-	if id.Kind == manga.Volume {
-		chaps = core.ParseSplits(id)
-	} else {
-		chaps = []*core.ChapSplit{
-			&core.ChapSplit{
-				Id:    id,
-				Num:   strconv.Itoa(id.Ordinal),
-				Title: *upBTitle,
-			},
+	var notes string
+	switch {
+	case m != "":
+		notes = m
+	case f != "":
+		var err error
+		if notes, err = util.ReadBody(f); err != nil {
+			cmd.Fatalln("error reading release notes:", err)
 		}
+	case util.NoInput && initial != "":
+		notes = initial
+	case util.NoInput:
+		cmd.Fatal("no release notes given (use -m or -F with -no-input)")
+	}
+	if notes != "" {
+		validatePost(cmd, notes)
+		return notes
 	}
 
-	batoto.Login()
-	seriesID, groupID, err := batoto.FindInfo(core.Config.Title, core.Config.Group)
-	if err != nil {
-		cmdUp.Fatalln("findInfo:", err)
+	if err := core.SaveDraft(core.ReleaseDraft, id.String(), initial); err != nil {
+		cmd.Fatalln("error writing release notes:", err)
 	}
 
-	t := make(job.Group, len(chaps))
-	chans := make([]chan struct{}, len(t))
-	for i, chap := range chaps {
-		chans[i] = make(chan struct{})
-		j := &batoto.ChapterUpload{chap, seriesID, groupID, *upBArchive, chans[i]}
-		t[i] = job.New(j, chap.String())
+	util.Launch(util.GetEditor(), path)
+	notes, err := core.LoadDraft(core.ReleaseDraft, id.String())
+	if err != nil && !os.IsNotExist(err) {
+		cmd.Fatalln("error reading release notes:", err)
 	}
+	if notes == initial && !resume {
+		core.RemoveDraft(core.ReleaseDraft, id.String())
+		cmd.Fatal("nothing changed in the editor; abort")
+	}
+	if err = reviewPost(cmd, fmt.Sprintf("%s %v", core.Config.Title, id), notes); err != nil {
+		cmd.Fatalf("%v (the notes are saved in %s; continue with them with -resume)", err, path)
+	}
+	return notes
+}
 
-	// upload files concurrently
-	go func() {
-		if err := t.Begin(); err != nil {
-			cmdUp.Fatal(err)
-		}
-	}()
+// planDisplaynone prints the requests displaynoneUpload would make.
+func planDisplaynone(r *dn.Release, files map[string]string) {
+	if !*upMeta {
+		plan("POST http://%s/upload  archive %q (%v)", core.Config.DLServ, r.Filename, util.Bytes(r.Filesize))
+	}
 
-	// post forms serially
-	for _, ch := range chans {
-		ch <- struct{}{}
-		<-ch
+	r.Notes = *upM
+	if r.Notes == "" {
+		r.Notes = "(from " + notesSource(*upM, *upF) + ")"
+	}
+	if *upResume {
+		r.Notes = "(from " + core.DraftPath(core.ReleaseDraft, core.Identifier{Kind: r.Kind, Ordinal: r.Ordinal}.String()) + ")"
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		cmdUp.Fatal(err)
+	}
+	plan("POST http://%s/release/create  data=%s", core.Config.Remote, data)
+	for field, name := range files {
+		plan("    %s: %s", field, name)
 	}
 }
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"ktkr.us/pkg/dn2/manga"
+
+	"ktkr.us/pkg/manga/batoto"
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/dn"
+	"ktkr.us/pkg/manga/util"
+)
+
+// An Uploader publishes releases to one destination site.
+type Uploader interface {
+	// Name is what the destination is called in .manga and on the command
+	// line.
+	Name() string
+
+	// Prepare gets everything ready to publish id, such as logging in and
+	// asking for release notes. Uploaders are prepared one at a time, so
+	// Prepare may prompt. In a dry run, it prints what the other methods
+	// would do instead.
+	Prepare(id core.Identifier) error
+
+	// Upload uploads the archive, sending progress to p.
+	Upload(p chan string) error
+
+	// Post posts the release metadata.
+	Post() error
+
+	// URL is where the release can be found once posted.
+	URL() string
+}
+
+// uploaders makes the known uploaders by name.
+var uploaders = map[string]func() Uploader{
+	"displaynone": func() Uploader { return new(displaynoneUploader) },
+	"batoto":      func() Uploader { return new(batotoUploader) },
+}
+
+// newUploader makes the uploader for the named destination: one of the built
+// in ones or a form or mirror destination from .manga.
+func newUploader(name string) (Uploader, bool) {
+	if mk, ok := uploaders[name]; ok {
+		return mk(), true
+	}
+	if dest, ok := core.Config.Forms[name]; ok {
+		return newFormUploader(name, dest), true
+	}
+	if dest, ok := core.Config.Mirrors[name]; ok {
+		return newMirrorUploader(name, dest), true
+	}
+	return nil, false
+}
+
+// uploaderNames lists the known destinations.
+func uploaderNames() []string {
+	seen := make(map[string]bool)
+	for name := range uploaders {
+		seen[name] = true
+	}
+	for name := range core.Config.Forms {
+		seen[name] = true
+	}
+	for name := range core.Config.Mirrors {
+		seen[name] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// publishJob adapts an Uploader to job.Job.
+type publishJob struct{ Uploader }
+
+func (j publishJob) Begin(p chan string) error {
+	if err := j.Upload(p); err != nil {
+		return err
+	}
+	p <- "Posting metadata..."
+	return j.Post()
+}
+
+type displaynoneUploader struct {
+	id     core.Identifier
+	client *dn.Client
+	r      *dn.Release
+	files  map[string]string
+	m      *core.Manifest
+}
+
+func (u *displaynoneUploader) Name() string { return "displaynone" }
+
+func (u *displaynoneUploader) Prepare(id core.Identifier) error {
+	client, err := dn.Default()
+	if err != nil {
+		return err
+	}
+	u.id, u.client = id, client
+
+	archiveFi, err := core.FirstArchive(id)
+	if err != nil {
+		return err
+	}
+
+	u.r = &dn.Release{
+		Release: manga.Release{
+			SeriesId: core.Config.Id,
+			Kind:     id.Kind,
+			Ordinal:  id.Ordinal,
+			Filename: archiveFi.Name(),
+			Filesize: manga.Filesize(archiveFi.Size()),
+			NSFW:     *upNSFW,
+			ISBN:     *upISBN,
+		},
+		Draft: *upDraft,
+	}
+	if *upAt != "" {
+		if *upDraft {
+			return fmt.Errorf("-draft and -at don't mix; publish drafts with manga release publish")
+		}
+		t, err := parsePublishTime(*upAt)
+		if err != nil {
+			return err
+		}
+		u.r.PublishAt = &t
+	}
+
+	u.files = coverFiles(id)
+	if err = checkCovers(cmdUp, id); err != nil {
+		return err
+	}
+
+	if *globalDryRun {
+		planDisplaynone(u.r, u.files)
+		return nil
+	}
+
+	data, err := newNotesData(&id)
+	if err != nil {
+		return err
+	}
+	tmpl, err := renderTemplate("release", data)
+	if err != nil {
+		return fmt.Errorf("release notes template: %v", err)
+	}
+	u.r.Notes = releaseNotes(cmdUp, id, *upM, *upF, tmpl, *upResume)
+
+	u.m, err = core.LoadManifest(id)
+	return err
+}
+
+func (u *displaynoneUploader) Upload(p chan string) error {
+	if *upMeta {
+		return nil
+	}
+	up, err := u.client.Upload(util.Rooted(u.r.Filename), p)
+	if err != nil {
+		return err
+	}
+	u.m.Shake256 = up.Shake256
+	return nil
+}
+
+func (u *displaynoneUploader) Post() error {
+	r, err := u.client.CreateRelease(u.r, u.files)
+	if err != nil {
+		return err
+	}
+	u.r = r
+
+	m := u.m
+	m.Id = r.Id
+	m.Filename = r.Filename
+	m.Filesize = int64(r.Filesize)
+	m.Notes = r.Notes
+	m.Uploaded = time.Now()
+	m.Draft = r.Draft
+	m.PublishAt = time.Time{}
+	if r.PublishAt != nil {
+		m.PublishAt = *r.PublishAt
+	}
+	if err = m.Save(u.id); err != nil {
+		return fmt.Errorf("saving release manifest: %v", err)
+	}
+	return core.RemoveDraft(core.ReleaseDraft, u.id.String())
+}
+
+func (u *displaynoneUploader) URL() string {
+	if u.r == nil || u.r.Id == 0 {
+		return ""
+	}
+	return u.client.BaseURL + "/release/" + strconv.Itoa(u.r.Id)
+}
+
+// batotoUploader uploads each chapter of a release to Batoto. Batoto's
+// chapter form refers to the file uploaded just before it, so the forms are
+// posted as part of Upload, and Post has nothing left to do.
+type batotoUploader struct {
+	seriesID string
+	chaps    []*batoto.ChapterUpload
+}
+
+func (u *batotoUploader) Name() string { return "batoto" }
+
+func (u *batotoUploader) Prepare(id core.Identifier) error {
+	var chaps []*core.ChapSplit
+	if id.Kind == manga.Volume {
+		chaps = core.ParseSplits(id)
+	} else {
+		chaps = []*core.ChapSplit{
+			&core.ChapSplit{
+				Id:    id,
+				Num:   strconv.Itoa(id.Ordinal),
+				Title: *upBTitle,
+			},
+		}
+	}
+
+	if *globalDryRun {
+		plan("log in to Batoto")
+		for _, chap := range chaps {
+			j := &batoto.ChapterUpload{Chap: chap, SeriesID: core.Config.BatotoID, GroupID: core.Config.BatotoGroupID, Archive: *upBArchive}
+			lines, err := j.Plan()
+			if err != nil {
+				return err
+			}
+			for _, line := range lines {
+				plan("%s", line)
+			}
+		}
+		return nil
+	}
+
+	batoto.Login()
+	seriesID, groupID, err := batoto.FindInfo(core.Config.Title, core.Config.Group)
+	if err != nil {
+		return fmt.Errorf("findInfo: %v", err)
+	}
+
+	u.seriesID = seriesID
+	for _, chap := range chaps {
+		u.chaps = append(u.chaps, &batoto.ChapterUpload{
+			Chap:     chap,
+			SeriesID: seriesID,
+			GroupID:  groupID,
+			Archive:  *upBArchive,
+			PostForm: make(chan struct{}),
+		})
+	}
+	return nil
+}
+
+func (u *batotoUploader) Upload(p chan string) error {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(u.chaps))
+		done = make([]chan struct{}, len(u.chaps))
+	)
+
+	// upload files concurrently
+	for i, chap := range u.chaps {
+		done[i] = make(chan struct{})
+		wg.Add(1)
+		go func(i int, chap *batoto.ChapterUpload) {
+			defer wg.Done()
+			defer close(done[i])
+
+			cp := make(chan string)
+			forwarded := make(chan struct{})
+			go func() {
+				for s := range cp {
+					p <- fmt.Sprintf("%v: %s", chap.Chap, s)
+				}
+				close(forwarded)
+			}()
+
+			errs[i] = chap.Begin(cp)
+			close(cp)
+			<-forwarded
+		}(i, chap)
+	}
+
+	// post forms serially, skipping chapters whose upload failed
+	for i, chap := range u.chaps {
+		select {
+		case chap.PostForm <- struct{}{}:
+			<-chap.PostForm
+		case <-done[i]:
+		}
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%v: %v", u.chaps[i].Chap, err)
+		}
+	}
+	return nil
+}
+
+func (u *batotoUploader) Post() error { return nil }
+
+func (u *batotoUploader) URL() string {
+	if u.seriesID == "" {
+		return ""
+	}
+	return batoto.SeriesURL(u.seriesID)
+}
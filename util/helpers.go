@@ -1,7 +1,6 @@
 package util
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -11,7 +10,13 @@ import (
 	"time"
 )
 
-func UploadFileProgress(host, reqPath string, formReader io.Reader, form *multipart.Writer,
+// UploadFileProgress posts formReader, totalSize bytes long, to url through
+// client, streaming it and sending progress to p, or printing it if p is nil.
+// If form is given, formReader is its body and the request is sent as a
+// multipart form. The fields in header are set on the request. The body is
+// sent chunked unless formReader is a file, when it is taken to be all of the
+// file.
+func UploadFileProgress(client *http.Client, url string, formReader io.Reader, form *multipart.Writer,
 	totalSize Bytes, header map[string]string, p chan string) (*http.Response, error) {
 
 	haveChan := true
@@ -20,50 +25,89 @@ func UploadFileProgress(host, reqPath string, formReader io.Reader, form *multip
 		haveChan = false
 	}
 
-	req, err := http.NewRequest("POST", reqPath, formReader)
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest("POST", url, pr)
 	if err != nil {
 		return nil, err
 	}
-	req.Host = host
 	if _, ok := formReader.(*os.File); ok {
 		req.ContentLength = int64(totalSize)
 	}
 	if form != nil {
-		req.Header.Set("Content-Type", "multipart/form-data; boundary="+form.Boundary())
+		req.Header.Set("Content-Type", form.FormDataContentType())
 	}
-	if header != nil {
-		for k, v := range header {
-			req.Header.Set(k, v)
-		}
+	for k, v := range header {
+		req.Header.Set(k, v)
 	}
 
-	conn, err := net.Dial("tcp", host)
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-
-	sw := NewStatWriter(conn, 16, 250*time.Millisecond, totalSize, p)
-	done := make(chan error)
+	sw := NewStatWriter(pw, 16, 250*time.Millisecond, totalSize, p)
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(sw, formReader)
+		pw.CloseWithError(err)
+		done <- err
+	}()
 
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	sent := make(chan result, 1)
 	go func() {
-		done <- req.Write(sw)
+		resp, err := client.Do(req)
+		// stop writing whatever of the body is left unread
+		pr.CloseWithError(err)
+		sent <- result{resp, err}
 	}()
 
+	printed := make(chan bool)
 	if !haveChan {
 		go func() {
 			for s := range p {
 				fmt.Fprintf(os.Stderr, "\033[J%s\033[0G", s)
 			}
 			fmt.Fprintln(os.Stderr)
+			printed <- true
 		}()
 	}
 
-	err = sw.Report(done)
-	if err != nil {
-		return nil, err
+	// a body that couldn't be read fails the request too, and a server that
+	// answers before reading all of it says why in the response
+	sw.Report(done)
+	if !haveChan {
+		close(p)
+		<-printed
 	}
+	r := <-sent
+	return r.resp, r.err
+}
+
+// FormSize returns the size of the body of form if fields are written to it
+// and then a file, size bytes long, named filename in field.
+func FormSize(form *multipart.Writer, fields map[string]string, field, filename string, size Bytes) Bytes {
+	var c countWriter
+	w := multipart.NewWriter(&c)
+	w.SetBoundary(form.Boundary())
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	w.CreateFormFile(field, filename)
+	w.Close()
+	return Bytes(c) + size
+}
 
-	r := bufio.NewReader(conn)
-	return http.ReadResponse(r, req)
+// countWriter counts the bytes written to it.
+type countWriter int64
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	*c += countWriter(len(p))
+	return len(p), nil
+}
+
+// HostPort adds :http to the host string if it has no port.
+func HostPort(host string) string {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		return net.JoinHostPort(host, "http")
+	}
+	return host
 }
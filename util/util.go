@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
@@ -192,8 +193,24 @@ func GetEditor() string {
 	return editor
 }
 
+// Set from the -yes and -no-input flags for scripted use.
+var (
+	AssumeYes bool // answer yes to every prompt
+	NoInput   bool // never read from the terminal or launch an editor
+)
+
+// Promptf asks a yes or no question. With AssumeYes the answer is always yes;
+// with NoInput alone the program exits instead of waiting for an answer.
 func Promptf(s string, args ...interface{}) bool {
 	fmt.Printf(s+" ", args...)
+	if AssumeYes {
+		fmt.Println("y")
+		return true
+	}
+	if NoInput {
+		fmt.Println()
+		log.Fatal("answer required (use -yes to accept prompts with -no-input)")
+	}
 	for {
 		in := ""
 		fmt.Scanln(&in)
@@ -209,6 +226,21 @@ func Promptf(s string, args ...interface{}) bool {
 	}
 }
 
+// ReadBody reads a post or release body from the named file, or from standard
+// input if name is "-".
+func ReadBody(name string) (string, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if name == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(name)
+	}
+	return string(data), err
+}
+
 func PrintStack(skip, count int) {
 	pcs := make([]uintptr, count)
 	s := runtime.Callers(skip, pcs)
@@ -235,6 +267,31 @@ func Plural(n int) string {
 	return "s"
 }
 
+// CopyFile copies the file at src to dst, replacing dst if it exists.
+func CopyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 func Rooted(in ...string) string {
 	wd, _ := os.Getwd()
 	s := filepath.Join(append([]string{core.TopLevel()}, in...)...)
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+	"time"
+
+	"ktkr.us/pkg/manga/core"
+)
+
+// HookData is what webhook payload templates can refer to: everything
+// release notes templates can, and the following.
+type HookData struct {
+	*NotesData
+	Event string // "release" or "news"
+	URL   string // of the release or news post
+	Text  string // release notes or news post body
+}
+
+// defaultPayload is sent to webhooks without a Payload template.
+const defaultPayload = `{
+	"event": {{json .Event}},
+	"series": {{json .Title}},
+	"identifier": {{if .Id}}{{json .Id.String}}{{else}}null{{end}},
+	"title": {{json .PostTitle}},
+	"chapters": [{{range $i, $c := .Chapters}}{{if $i}}, {{end}}{"num": {{json $c.Num}}, "title": {{json $c.Title}}}{{end}}],
+	"url": {{json .URL}},
+	"download": {{json .DownloadURL}},
+	"size": {{json .Size.String}},
+	"text": {{json .Text}}
+}`
+
+var hookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+var (
+	// hookClient sends webhooks.
+	hookClient = &http.Client{Timeout: 30 * time.Second}
+
+	// hookDelay is how long to wait before trying a webhook again the first
+	// time. It doubles with every try.
+	hookDelay = time.Second
+)
+
+// fireWebhooks notifies the webhooks in .manga that want event. Failures are
+// reported but don't stop anything, as whatever they announce has already
+// happened.
+func fireWebhooks(cmd *Command, data *HookData) {
+	for _, hook := range core.Config.Webhooks {
+		if !hook.Wants(data.Event) {
+			continue
+		}
+
+		payload, err := hookPayload(hook, data)
+		if err != nil {
+			cmd.Printf("webhook %s: %v", hook.URL, err)
+			continue
+		}
+		if *globalDryRun {
+			plan("POST %s  %s", hook.URL, payload)
+			continue
+		}
+
+		if err = sendHook(hook, payload); err != nil {
+			cmd.Printf("webhook %s: %v", hook.URL, err)
+		}
+	}
+}
+
+// hookPayload renders the payload of hook and checks that it is valid JSON.
+func hookPayload(hook *core.Webhook, data *HookData) ([]byte, error) {
+	text := hook.Payload
+	if text == "" {
+		text = defaultPayload
+	}
+	t, err := template.New("payload").Funcs(hookFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err = t.Execute(buf, data); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("payload isn't valid JSON: %s", buf)
+	}
+	return buf.Bytes(), nil
+}
+
+// sendHook posts payload to hook, trying again with increasing delays if the
+// request fails or the server has trouble (5xx or 429).
+func sendHook(hook *core.Webhook, payload []byte) error {
+	retries := hook.Retries
+	if retries <= 0 {
+		retries = 3
+	}
+
+	var err error
+	delay := hookDelay
+	for try := 0; try <= retries; try++ {
+		if try > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		var retry bool
+		if retry, err = postHook(hook, payload); err == nil || !retry {
+			return err
+		}
+	}
+	return fmt.Errorf("giving up after %d tries: %v", retries+1, err)
+}
+
+func postHook(hook *core.Webhook, payload []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range hook.Header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := hookClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("server returned %s", resp.Status)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ktkr.us/pkg/dn2/manga"
+
+	"ktkr.us/pkg/manga/core"
+	"ktkr.us/pkg/manga/util"
+)
+
+func testHookData() *HookData {
+	id := core.Identifier{Kind: manga.Volume, Ordinal: 3}
+	return &HookData{
+		NotesData: &NotesData{
+			Title: `Series "Title"`,
+			Id:    &id,
+			Chapters: []*ChapterInfo{
+				{Num: "12", Title: "Start"},
+				{Num: "13", Title: "End"},
+			},
+			Size:        3 * util.MiB,
+			DownloadURL: "http://dl.example.com/Title%20v03.zip",
+		},
+		Event: "release",
+		URL:   "http://example.com/release/9",
+		Text:  "notes with \"quotes\"\nand lines",
+	}
+}
+
+func TestHookPayload(t *testing.T) {
+	payload, err := hookPayload(&core.Webhook{URL: "http://example.com"}, testHookData())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Event, Series, Title, URL, Download, Size, Text string
+		Identifier                                      *string
+		Chapters                                        []struct{ Num, Title string }
+	}
+	if err = json.Unmarshal(payload, &got); err != nil {
+		t.Fatalf("%v: %s", err, payload)
+	}
+	if got.Event != "release" || got.Series != `Series "Title"` || got.Identifier == nil || *got.Identifier != "v03" ||
+		got.URL != "http://example.com/release/9" || got.Download != "http://dl.example.com/Title%20v03.zip" ||
+		got.Size != (3*util.MiB).String() || got.Text != "notes with \"quotes\"\nand lines" {
+		t.Errorf("payload decoded as %+v", got)
+	}
+	if len(got.Chapters) != 2 || got.Chapters[1].Num != "13" || got.Chapters[1].Title != "End" {
+		t.Errorf("chapters decoded as %+v", got.Chapters)
+	}
+
+	// news posts have no identifier
+	data := testHookData()
+	data.Event, data.Id, data.Chapters, data.PostTitle = "news", nil, nil, "Hello"
+	if payload, err = hookPayload(&core.Webhook{}, data); err != nil {
+		t.Fatal(err)
+	}
+	var news map[string]interface{}
+	if err = json.Unmarshal(payload, &news); err != nil {
+		t.Fatalf("%v: %s", err, payload)
+	}
+	if id, ok := news["identifier"]; !ok || id != nil || news["title"] != "Hello" {
+		t.Errorf("news payload decoded as %v", news)
+	}
+}
+
+func TestHookPayloadTemplate(t *testing.T) {
+	hook := &core.Webhook{Payload: `{"content": {{json (printf "%s %v is out! %s" .Title .Id .URL)}}}`}
+	payload, err := hookPayload(hook, testHookData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"content": "Series \"Title\" v03 is out! http://example.com/release/9"}`
+	if string(payload) != want {
+		t.Errorf("payload %s, want %s", payload, want)
+	}
+
+	// templates that don't make JSON are caught before anything is sent
+	for _, text := range []string{`{"content": {{.Title}}}`, `{{.Nothing}}`, `{{`} {
+		if _, err = hookPayload(&core.Webhook{Payload: text}, testHookData()); err == nil {
+			t.Errorf("payload template %s accepted", text)
+		}
+	}
+}
+
+// hookServer answers the webhook requests it gets with the statuses in turn,
+// recording when each came and what it carried.
+type hookServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	times    []time.Time
+	bodies   []string
+	headers  []http.Header
+}
+
+func newHookServer(statuses ...int) *hookServer {
+	s := &hookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		n := len(s.times)
+		s.times = append(s.times, time.Now())
+		s.bodies = append(s.bodies, string(body))
+		s.headers = append(s.headers, r.Header)
+		status := http.StatusOK
+		if n < len(s.statuses) {
+			status = s.statuses[n]
+		}
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func (s *hookServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.times)
+}
+
+func TestSendHook(t *testing.T) {
+	defer func(d time.Duration) { hookDelay = d }(hookDelay)
+	hookDelay = 20 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		requests int
+		err      string
+	}{
+		{"ok", []int{204}, 0, 1, ""},
+		{"5xx then ok", []int{500, 503, 200}, 0, 3, ""},
+		{"rate limited", []int{429, 200}, 0, 2, ""},
+		{"other 4xx", []int{404, 200}, 0, 1, "404"},
+		{"gives up", []int{502, 502, 502, 502, 502}, 0, 4, "giving up after 4 tries"},
+		{"own retries", []int{500, 500, 500}, 2, 3, "giving up after 3 tries"},
+	}
+	for _, tt := range tests {
+		s := newHookServer(tt.statuses...)
+		hook := &core.Webhook{URL: s.URL, Retries: tt.retries, Header: map[string]string{"X-Key": "secret"}}
+		err := sendHook(hook, []byte(`{"a": 1}`))
+		s.Close()
+
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: error %v, want one with %q", tt.name, err, tt.err)
+		}
+		if n := s.requests(); n != tt.requests {
+			t.Errorf("%s: %d requests, want %d", tt.name, n, tt.requests)
+		}
+		for i, body := range s.bodies {
+			if body != `{"a": 1}` || s.headers[i].Get("Content-Type") != "application/json" || s.headers[i].Get("X-Key") != "secret" {
+				t.Errorf("%s: request %d had body %s and header %v", tt.name, i, body, s.headers[i])
+			}
+		}
+
+		// each wait is about twice as long as the one before
+		for i := 2; i < len(s.times); i++ {
+			prev, gap := s.times[i-1].Sub(s.times[i-2]), s.times[i].Sub(s.times[i-1])
+			if gap < 2*hookDelay<<uint(i-2) || gap < prev*3/2 {
+				t.Errorf("%s: waited %v then %v before request %d", tt.name, prev, gap, i+1)
+			}
+		}
+	}
+}
+
+func TestSendHookUnreachable(t *testing.T) {
+	defer func(d time.Duration) { hookDelay = d }(hookDelay)
+	hookDelay = time.Millisecond
+
+	s := newHookServer()
+	url := s.URL
+	s.Close()
+
+	err := sendHook(&core.Webhook{URL: url, Retries: 1}, []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "giving up after 2 tries") {
+		t.Errorf("error %v, want giving up after 2 tries", err)
+	}
+}